@@ -2,6 +2,7 @@ import { createContext, useContext, useState, useEffect } from 'react'
 import { PublicKey, PrivateKey } from '@/utils/elgamal'
 import { encryptForLocalStorage, decryptFromLocalStorage } from '@/utils/cryptoUtils'
 import { websocketService } from '@/services/websocketService'
+import { authService } from '@/services/authService'
 
 interface AuthState {
   userId: string | null
@@ -11,7 +12,7 @@ interface AuthState {
 }
 
 interface AuthContextType extends AuthState {
-  setAuthState: (userId: string, publicKey: PublicKey, privateKey: PrivateKey, token: string) => void
+  setAuthState: (userId: string, publicKey: PublicKey, privateKey: PrivateKey, token: string, refreshToken: string) => void
   clearAuth: () => void
 }
 
@@ -43,7 +44,8 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
     userId: string,
     publicKey: PublicKey,
     privateKey: PrivateKey,
-    token: string
+    token: string,
+    refreshToken: string
   ) => {
     const encryptedPrivateKeyLocal = await encryptForLocalStorage(
       JSON.stringify(privateKey)
@@ -52,6 +54,7 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
     localStorage.setItem('userId', userId)
     localStorage.setItem('publicKey', JSON.stringify(publicKey))
     localStorage.setItem('token', token)
+    localStorage.setItem('refreshToken', refreshToken)
     localStorage.setItem('encryptedPrivateKeyLocal', encryptedPrivateKeyLocal)
 
     setAuthState({
@@ -63,10 +66,14 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
   }
 
   const clearAuth = () => {
+    authService.logout().catch(console.error)
+
     localStorage.removeItem('userId')
     localStorage.removeItem('publicKey')
     localStorage.removeItem('token')
+    localStorage.removeItem('refreshToken')
     localStorage.removeItem('encryptedPrivateKeyLocal')
+    localStorage.removeItem('wsCursor')
 
     setAuthState({
       userId: null,
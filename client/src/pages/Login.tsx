@@ -5,8 +5,8 @@ import { Input } from '@/components/ui/input'
 import { Label } from '@/components/ui/label'
 import { useToast } from '@/hooks/use-toast'
 import { useAuth } from '@/contexts/AuthContext'
-import { authService } from '@/services/authService'
-import { decryptPrivateKey } from '@/utils/cryptoUtils'
+import { authService, AuthResponse } from '@/services/authService'
+import { decryptPrivateKey, KEY_WRAP_VERSION } from '@/utils/cryptoUtils'
 import {
   Card,
   CardHeader,
@@ -26,6 +26,33 @@ export default function Login() {
   const [lockoutUntil, setLockoutUntil] = useState<Date | null>(null)
   const [isLoading, setIsLoading] = useState(false)
   const [showPassword, setShowPassword] = useState(false)
+  const [challengeToken, setChallengeToken] = useState<string | null>(null)
+  const [code, setCode] = useState('')
+
+  // Abre a sessão com a resposta do login, decifrando a chave privada com a senha
+  const completeLogin = async (response: AuthResponse) => {
+    const privateKey = await decryptPrivateKey(
+      response.encryptedPrivateKey,
+      password,
+      response.keyWrap
+    )
+
+    // Atualizar o contexto com as informações necessárias
+    await setAuthState(
+      response.user.id,
+      response.publicKey,
+      privateKey,
+      response.token,
+      response.refreshToken
+    )
+
+    // Contas antigas usam o salt fixo; recifrar com um salt próprio sem bloquear o login
+    if (response.keyWrap.version < KEY_WRAP_VERSION) {
+      authService.rewrapPrivateKey(password, privateKey).catch(console.error)
+    }
+
+    navigate('/')
+  }
 
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault()
@@ -46,21 +73,13 @@ export default function Login() {
       // Autenticar com o backend personalizado
       const response = await authService.login(username, password)
 
-      // Descriptografar a chave privada
-      const privateKey = await decryptPrivateKey(
-        response.encryptedPrivateKey,
-        password
-      )
-
-      // Atualizar o contexto com as informações necessárias
-      await setAuthState(
-        response.user.id,
-        response.publicKey,
-        privateKey,
-        response.token
-      )
-
-      navigate('/')
+      // Contas com dois fatores pedem o código antes de abrir a sessão
+      if ('twoFactorRequired' in response) {
+        setChallengeToken(response.challengeToken)
+        return
+      }
+
+      await completeLogin(response)
     } catch (error: any) {
       setLoginAttempts(prev => prev + 1)
 
@@ -82,6 +101,31 @@ export default function Login() {
     }
   }
 
+  const handleCodeSubmit = async (e: React.FormEvent) => {
+    e.preventDefault()
+    if (!challengeToken) return
+
+    try {
+      setIsLoading(true)
+      const response = await authService.loginTwoFactor(challengeToken, code)
+      await completeLogin(response)
+    } catch (error: any) {
+      setCode('')
+      toast({
+        variant: "destructive",
+        title: "Erro ao verificar código",
+        description: error instanceof Error ? error.message : "Tente novamente."
+      })
+
+      // Desafio vencido ou tentativas esgotadas: voltar ao formulário de senha
+      if (error instanceof Error && error.message.includes('desafio')) {
+        setChallengeToken(null)
+      }
+    } finally {
+      setIsLoading(false)
+    }
+  }
+
   if (isLoading) {
     return (
       <Card className="w-full bg-gray-900/70 backdrop-blur-sm border-gray-800 shadow-xl">
@@ -92,6 +136,55 @@ export default function Login() {
     )
   }
 
+  if (challengeToken) {
+    return (
+      <Card className="w-full max-w-md mx-auto bg-gray-900/70 backdrop-blur-sm border-gray-800 shadow-xl">
+        <CardHeader className="space-y-1 pb-2">
+          <h2 className="text-xl md:text-2xl font-bold text-center text-white">
+            Verificação em duas etapas
+          </h2>
+          <p className="text-xs md:text-sm text-gray-400 text-center">
+            Digite o código do seu aplicativo autenticador ou um código de recuperação
+          </p>
+        </CardHeader>
+        <CardContent className="pb-4 px-4 md:px-6">
+          <form onSubmit={handleCodeSubmit} className="space-y-4">
+            <div className="space-y-2">
+              <Label htmlFor="code" className="text-gray-200 text-sm md:text-base">Código</Label>
+              <Input
+                id="code"
+                type="text"
+                inputMode="text"
+                autoComplete="one-time-code"
+                placeholder="123456"
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+                required
+                autoFocus
+                className="bg-gray-800/50 border-gray-700 text-white placeholder:text-gray-500 focus:border-blue-500 focus:ring-blue-500 text-sm md:text-base h-9 md:h-10"
+              />
+            </div>
+            <Button
+              type="submit"
+              className="w-full bg-blue-600 hover:bg-blue-700 text-white font-medium transition-colors text-sm md:text-base py-2 h-9 md:h-10"
+            >
+              Verificar
+            </Button>
+          </form>
+        </CardContent>
+        <CardFooter className="flex justify-center border-t border-gray-800 pt-4 px-4 md:px-6">
+          <Button
+            variant="link"
+            onClick={() => { setChallengeToken(null); setCode('') }}
+            className="text-blue-400 hover:text-blue-300 text-sm md:text-base"
+          >
+            Voltar
+          </Button>
+        </CardFooter>
+      </Card>
+    )
+  }
+
   return (
     <Card className="w-full max-w-md mx-auto bg-gray-900/70 backdrop-blur-sm border-gray-800 shadow-xl">
       <CardHeader className="space-y-1 pb-2">
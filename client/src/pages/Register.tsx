@@ -92,7 +92,7 @@ export default function Register() {
       setStep('generating');
 
       // Gerar chaves em segundo plano usando Web Worker
-      const { publicKey, privateKey, encryptedPrivateKey } = await keyGenService.generateKeysAsync(password);
+      const { publicKey, privateKey, encryptedPrivateKey, keyWrap } = await keyGenService.generateKeysAsync(password);
 
       // Alterar para o passo de submissão ao servidor
       setStep('submitting');
@@ -102,7 +102,8 @@ export default function Register() {
         username,
         password,
         publicKey,
-        encryptedPrivateKey
+        encryptedPrivateKey,
+        keyWrap
       );
 
       // Atualizar o contexto com as informações do usuário
@@ -110,7 +111,8 @@ export default function Register() {
         response.user.id,
         response.publicKey,
         privateKey,
-        response.token
+        response.token,
+        response.refreshToken
       )
 
       toast({
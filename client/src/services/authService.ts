@@ -1,8 +1,11 @@
-import { ElGamal } from '@/utils/elgamal'
-import { encryptPrivateKey } from '@/utils/cryptoUtils'
+import { ElGamal, PrivateKey } from '@/utils/elgamal'
+import { createKeyWrapParams, encryptPrivateKey, KeyWrapParams } from '@/utils/cryptoUtils'
 
-interface AuthResponse {
+export interface AuthResponse {
   token: string
+  expiresAt: string
+  refreshToken: string
+  sessionId: string
   user: {
     id: string
     username: string
@@ -13,8 +16,26 @@ interface AuthResponse {
     y: string
   }
   encryptedPrivateKey: string
+  keyWrap: KeyWrapParams
 }
 
+// Resposta do login quando a conta exige o segundo fator
+export interface TwoFactorChallenge {
+  twoFactorRequired: true
+  challengeToken: string
+  challengeExpiresAt: string
+}
+
+export interface TwoFactorStatus {
+  enabled: boolean
+  recoveryCodesRemaining: number
+}
+
+const authHeaders = () => ({
+  'Content-Type': 'application/json',
+  'Authorization': `Bearer ${localStorage.getItem('token')}`
+})
+
 export const API_BASE_URL = import.meta.env.VITE_API_URL as string || "https://localhost:8080";
 
 export const authService = {
@@ -24,7 +45,8 @@ export const authService = {
     const { publicKey, privateKey } = elgamal
 
     // Criptografar chave privada com a senha do usuário
-    const encryptedPrivateKey = await encryptPrivateKey(privateKey, password)
+    const keyWrap = createKeyWrapParams()
+    const encryptedPrivateKey = await encryptPrivateKey(privateKey, password, keyWrap)
 
     const response = await fetch(`${API_BASE_URL}/auth/register`, {
       method: 'POST',
@@ -33,7 +55,8 @@ export const authService = {
         username,
         password,
         publicKey,
-        encryptedPrivateKey
+        encryptedPrivateKey,
+        keyWrap
       })
     })
 
@@ -49,7 +72,8 @@ export const authService = {
     username: string,
     password: string,
     publicKey: ElGamal['publicKey'],
-    encryptedPrivateKey: string
+    encryptedPrivateKey: string,
+    keyWrap: KeyWrapParams
   ) {
     const response = await fetch(`${API_BASE_URL}/auth/register`, {
       method: 'POST',
@@ -58,7 +82,8 @@ export const authService = {
         username,
         password,
         publicKey,
-        encryptedPrivateKey
+        encryptedPrivateKey,
+        keyWrap
       })
     })
 
@@ -82,7 +107,141 @@ export const authService = {
       throw new Error(error.error || 'Credenciais inválidas')
     }
 
-    const data = await response.json() as AuthResponse
+    const data = await response.json() as AuthResponse | TwoFactorChallenge
     return data
+  },
+
+  // Conclui o login com o código do autenticador ou um código de recuperação
+  async loginTwoFactor(challengeToken: string, code: string) {
+    const response = await fetch(`${API_BASE_URL}/auth/login/2fa`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ challengeToken, code })
+    })
+
+    if (!response.ok) {
+      const error = await response.json()
+      throw new Error(error.error || 'Código inválido')
+    }
+
+    return await response.json() as AuthResponse
+  },
+
+  async getTwoFactorStatus() {
+    const response = await fetch(`${API_BASE_URL}/api/user/2fa`, { headers: authHeaders() })
+    if (!response.ok) {
+      throw new Error('Erro ao buscar configuração de dois fatores')
+    }
+    return await response.json() as TwoFactorStatus
+  },
+
+  // Gera o segredo do autenticador; o uri otpauth:// deve ser exibido como QR code
+  async setupTwoFactor() {
+    return await twoFactorRequest<{ secret: string; uri: string }>('/setup', {})
+  },
+
+  // Confirma o autenticador; os códigos de recuperação só são exibidos nesta resposta
+  async enableTwoFactor(code: string) {
+    return await twoFactorRequest<{ recoveryCodes: string[] }>('/enable', { code })
+  },
+
+  async regenerateRecoveryCodes(code: string) {
+    return await twoFactorRequest<{ recoveryCodes: string[] }>('/recovery-codes', { code })
+  },
+
+  async disableTwoFactor(password: string, code: string) {
+    await twoFactorRequest<void>('/disable', { password, code })
+  },
+
+  // Troca o refresh token salvo por um novo par de tokens; o refresh token anterior deixa de valer
+  async refresh() {
+    const refreshToken = localStorage.getItem('refreshToken')
+    if (!refreshToken) {
+      throw new Error('Sessão expirada')
+    }
+
+    const response = await fetch(`${API_BASE_URL}/auth/refresh`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refreshToken })
+    })
+
+    if (!response.ok) {
+      throw new Error('Sessão expirada')
+    }
+
+    const data = await response.json() as Pick<AuthResponse, 'token' | 'expiresAt' | 'refreshToken'>
+    localStorage.setItem('token', data.token)
+    localStorage.setItem('refreshToken', data.refreshToken)
+    return data.token
+  },
+
+  // Recifra a chave privada com um salt novo, usado ao migrar contas com parâmetros antigos
+  async rewrapPrivateKey(password: string, privateKey: PrivateKey) {
+    const keyWrap = createKeyWrapParams()
+    const encryptedPrivateKey = await encryptPrivateKey(privateKey, password, keyWrap)
+
+    const response = await fetch(`${API_BASE_URL}/api/user/keys`, {
+      method: 'PUT',
+      headers: {
+        'Content-Type': 'application/json',
+        'Authorization': `Bearer ${localStorage.getItem('token')}`
+      },
+      body: JSON.stringify({ currentPassword: password, encryptedPrivateKey, keyWrap })
+    })
+
+    if (!response.ok) {
+      const error = await response.json()
+      throw new Error(error.error || 'Erro ao atualizar chaves')
+    }
+  },
+
+  // Troca a senha recifrando a chave privada com a nova senha; as outras sessões são encerradas
+  async changePassword(oldPassword: string, newPassword: string, privateKey: PrivateKey) {
+    const keyWrap = createKeyWrapParams()
+    const encryptedPrivateKey = await encryptPrivateKey(privateKey, newPassword, keyWrap)
+
+    const response = await fetch(`${API_BASE_URL}/api/user/password`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+        'Authorization': `Bearer ${localStorage.getItem('token')}`
+      },
+      body: JSON.stringify({ oldPassword, newPassword, encryptedPrivateKey, keyWrap })
+    })
+
+    if (!response.ok) {
+      const error = await response.json()
+      throw new Error(error.error || 'Erro ao trocar senha')
+    }
+
+    return await response.json() as { revokedSessions: number }
+  },
+
+  // Encerra a sessão no servidor, que também desconecta o WebSocket dela
+  async logout() {
+    const refreshToken = localStorage.getItem('refreshToken')
+    if (!refreshToken) return
+
+    await fetch(`${API_BASE_URL}/auth/logout`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refreshToken })
+    })
+  }
+}
+
+async function twoFactorRequest<T>(path: string, body: Record<string, string>): Promise<T> {
+  const response = await fetch(`${API_BASE_URL}/api/user/2fa${path}`, {
+    method: 'POST',
+    headers: authHeaders(),
+    body: JSON.stringify(body)
+  })
+
+  if (!response.ok) {
+    const error = await response.json()
+    throw new Error(error.error || 'Erro na autenticação em dois fatores')
   }
-}
\ No newline at end of file
+
+  return (response.status === 204 ? undefined : await response.json()) as T
+}
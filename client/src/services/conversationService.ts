@@ -38,7 +38,7 @@ export const conversationService = {
     }
   },
 
-  async sendMessage(conversationId: string, content: string, participants: ConversationDetails['participants']): Promise<Message> {
+  async sendMessage(conversationId: string, content: string, participants: ConversationDetails['participants'], clientMessageId: string = crypto.randomUUID()): Promise<Message> {
     const elgamal = new ElGamal()
     const encryptedContents: { [key: string]: any } = {}
 
@@ -53,7 +53,7 @@ export const conversationService = {
         'Content-Type': 'application/json',
         'Authorization': `Bearer ${localStorage.getItem('token')}`
       },
-      body: JSON.stringify({ encryptedContents })
+      body: JSON.stringify({ encryptedContents, clientMessageId })
     })
 
     if (!response.ok) {
@@ -1,9 +1,11 @@
 import { PublicKey, PrivateKey } from '@/utils/elgamal';
+import { KeyWrapParams } from '@/utils/cryptoUtils';
 
 interface KeyGenResult {
   publicKey: PublicKey;
   privateKey: PrivateKey;
   encryptedPrivateKey: string;
+  keyWrap: KeyWrapParams;
 }
 
 class KeyGenerationService {
@@ -0,0 +1,89 @@
+// Esquema dos frames WebSocket; deve acompanhar server/websocket/protocol.go
+// e docs/protocolo-websocket.md
+export const PROTOCOL_VERSION = 1
+
+export type ClientFrameType =
+  | 'message'
+  | 'edit_message'
+  | 'delete_message'
+  | 'read'
+  | 'typing_start'
+  | 'typing_stop'
+
+export interface ClientFrame {
+  v: number
+  type: ClientFrameType
+  requestId: string
+  payload: Record<string, unknown>
+}
+
+export interface AckPayload {
+  requestId: string
+  status: 'ok' | 'created' | 'duplicate'
+  messageId?: string
+  clientMessageId?: string
+}
+
+export interface ErrorPayload {
+  requestId: string
+  code: string
+  message: string
+}
+
+export interface ServerFrame {
+  v: number
+  type: string
+  payload: any
+}
+
+// Campos obrigatórios do payload de cada tipo de frame recebido do servidor
+const serverFields: Record<string, string[]> = {
+  ack: ['requestId', 'status'],
+  error: ['requestId', 'code', 'message'],
+  message: ['id', 'conversationId', 'seq', 'senderId'],
+  sync_complete: ['cursor'],
+  conversation_update: [],
+  message_edited: ['id', 'conversationId'],
+  message_deleted: ['id', 'conversationId'],
+  messages_expired: ['conversationId', 'messageIds'],
+  receipt: ['conversationId', 'recipientId', 'status', 'messageIds'],
+  typing_start: ['conversationId', 'userId'],
+  typing_stop: ['conversationId', 'userId'],
+  presence: ['userId', 'status'],
+  group_update: ['conversationId', 'event'],
+  sender_key: ['conversationId', 'senderId', 'epoch', 'keyId'],
+  sender_key_rotation: ['conversationId', 'epoch']
+}
+
+// Valida um frame recebido do servidor, retornando null quando não segue o esquema
+export function parseServerFrame(data: string): ServerFrame | null {
+  let frame: any
+  try {
+    frame = JSON.parse(data)
+  } catch {
+    return null
+  }
+
+  if (!frame || frame.v !== PROTOCOL_VERSION || typeof frame.type !== 'string') {
+    return null
+  }
+
+  const required = serverFields[frame.type]
+  if (!required || typeof frame.payload !== 'object' || frame.payload === null) {
+    return null
+  }
+  if (required.some(field => !(field in frame.payload))) {
+    return null
+  }
+
+  return frame as ServerFrame
+}
+
+export function createFrame(type: ClientFrameType, payload: Record<string, unknown>): ClientFrame {
+  return {
+    v: PROTOCOL_VERSION,
+    type,
+    requestId: crypto.randomUUID(),
+    payload
+  }
+}
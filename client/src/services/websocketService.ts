@@ -1,8 +1,26 @@
 import { Message } from '@/types/chat'
 import { ElGamal } from '@/utils/elgamal'
+import { authService } from './authService'
+import { AckPayload, ClientFrameType, ErrorPayload, createFrame, parseServerFrame } from './protocol'
 
 type ConversationUpdateHandler = () => void
 
+// Tempo máximo de espera pelo ack de um frame enviado
+const REQUEST_TIMEOUT = 10000
+
+interface PendingRequest {
+  resolve: (ack: AckPayload) => void
+  reject: (error: Error) => void
+  timeout: ReturnType<typeof setTimeout>
+}
+
+// Erro devolvido pelo servidor para um frame, com o código do protocolo
+export class WebSocketRequestError extends Error {
+  constructor(public code: string, message: string) {
+    super(message)
+  }
+}
+
 export class WebSocketService {
   private static instance: WebSocketService
   private ws: WebSocket | null = null
@@ -13,6 +31,10 @@ export class WebSocketService {
   private reconnectDelay = 3000
   private pendingMessages = new Map<string, Message[]>()
   private reconnectTimeout: NodeJS.Timeout | null = null
+  // IDs já entregues aos handlers; o servidor pode reenviar mensagens ao reconectar
+  private seenMessageIds = new Set<string>()
+  // Frames aguardando ack ou erro, indexados por requestId
+  private pendingRequests = new Map<string, PendingRequest>()
 
   private constructor() {}
 
@@ -28,8 +50,18 @@ export class WebSocketService {
       return
     }
 
+    const token = localStorage.getItem('token')
+    if (!token) {
+      console.error('Token não encontrado, WebSocket não será conectado')
+      return
+    }
+
+    // O token é enviado como subprotocolo, pois o navegador não permite o cabeçalho Authorization
     const wsUrl = import.meta.env.VITE_WS_URL || 'ws://localhost:8080'
-    this.ws = new WebSocket(`${wsUrl}/ws?userId=${userId}`)
+    // A última sequência recebida em cada conversa permite ao servidor reenviar o que chegou offline
+    const cursor = localStorage.getItem('wsCursor')
+    const query = cursor ? `?cursor=${encodeURIComponent(cursor)}` : ''
+    this.ws = new WebSocket(`${wsUrl}/ws${query}`, ['bearer', token])
 
     this.ws.onopen = () => {
       console.log('WebSocket conectado')
@@ -38,7 +70,11 @@ export class WebSocketService {
 
     this.ws.onmessage = (event) => {
       try {
-        const wsMessage = JSON.parse(event.data)
+        const wsMessage = parseServerFrame(event.data)
+        if (!wsMessage) {
+          console.error('Frame fora do protocolo descartado:', event.data)
+          return
+        }
 
         switch (wsMessage.type) {
           case 'message':
@@ -47,14 +83,42 @@ export class WebSocketService {
           case 'conversation_update':
             this.notifyConversationUpdate()
             break
+          case 'message_edited':
+          case 'message_deleted':
+            // A conversa é recarregada do servidor; basta registrar a alteração no cursor
+            if (typeof wsMessage.payload.changeSeq === 'number') {
+              this.advanceCursor(wsMessage.payload.conversationId, 0, wsMessage.payload.changeSeq)
+            }
+            this.notifyConversationUpdate()
+            break
+          case 'ack':
+            // Confirma o frame enviado; 'duplicate' indica um reenvio já salvo
+            this.resolveRequest(wsMessage.payload as AckPayload)
+            break
+          case 'error':
+            this.rejectRequest(wsMessage.payload as ErrorPayload)
+            break
+          case 'sync_complete':
+            if (wsMessage.payload?.cursor) {
+              localStorage.setItem('wsCursor', wsMessage.payload.cursor)
+            }
+            break
         }
       } catch (error) {
         console.error('Erro ao processar mensagem:', error)
       }
     }
 
-    this.ws.onclose = () => {
+    this.ws.onclose = (event) => {
       console.log('WebSocket desconectado')
+      this.failPendingRequests()
+      // 4001: token expirado; renovar a sessão antes de reconectar
+      if (event.code === 4001) {
+        authService.refresh()
+          .then(() => this.connect(userId))
+          .catch(error => console.error('Erro ao renovar sessão:', error))
+        return
+      }
       this.handleReconnect(userId)
     }
 
@@ -63,6 +127,53 @@ export class WebSocketService {
     }
   }
 
+  // Envia um frame e aguarda a resposta do servidor com o mesmo requestId
+  private request(type: ClientFrameType, payload: Record<string, unknown>): Promise<AckPayload> {
+    if (!this.ws || this.ws.readyState !== WebSocket.OPEN) {
+      return Promise.reject(new Error('WebSocket não está conectado'))
+    }
+
+    const frame = createFrame(type, payload)
+    return new Promise((resolve, reject) => {
+      const timeout = setTimeout(() => {
+        this.pendingRequests.delete(frame.requestId)
+        reject(new Error('Tempo esgotado aguardando confirmação do servidor'))
+      }, REQUEST_TIMEOUT)
+
+      this.pendingRequests.set(frame.requestId, { resolve, reject, timeout })
+      this.ws!.send(JSON.stringify(frame))
+    })
+  }
+
+  private resolveRequest(ack: AckPayload) {
+    const pending = this.pendingRequests.get(ack.requestId)
+    if (!pending) return
+
+    clearTimeout(pending.timeout)
+    this.pendingRequests.delete(ack.requestId)
+    pending.resolve(ack)
+  }
+
+  private rejectRequest(error: ErrorPayload) {
+    const pending = this.pendingRequests.get(error.requestId)
+    if (!pending) {
+      console.error('Erro do servidor:', error)
+      return
+    }
+
+    clearTimeout(pending.timeout)
+    this.pendingRequests.delete(error.requestId)
+    pending.reject(new WebSocketRequestError(error.code, error.message))
+  }
+
+  private failPendingRequests() {
+    this.pendingRequests.forEach(pending => {
+      clearTimeout(pending.timeout)
+      pending.reject(new Error('Conexão encerrada antes da confirmação do servidor'))
+    })
+    this.pendingRequests.clear()
+  }
+
   private handleNewMessage(payload: any) {
     console.log('Payload WebSocket recebido:', payload)
 
@@ -75,9 +186,17 @@ export class WebSocketService {
       }
     }
 
-    const { id, conversationId, senderId, createdAt, encryptedContents } = payload
+    const { id, conversationId, senderId, createdAt, encryptedContents, seq } = payload
     const userId = localStorage.getItem('userId')
 
+    if (typeof seq === 'number') {
+      this.advanceCursor(conversationId, seq, 0)
+    }
+    if (this.seenMessageIds.has(id)) {
+      return
+    }
+    this.seenMessageIds.add(id)
+
     if (!userId || !encryptedContents || !encryptedContents[userId]) {
       console.error('Conteúdo criptografado não encontrado para usuário:', userId)
       return
@@ -86,6 +205,7 @@ export class WebSocketService {
     const message: Message = {
       id,
       conversationId,
+      seq,
       senderId,
       content: encryptedContents[userId],
       createdAt
@@ -108,6 +228,26 @@ export class WebSocketService {
     }
   }
 
+  // Atualiza o cursor de sincronização, no formato "conversationId:seq:changeSeq" separado
+  // por vírgulas; a última parte é omitida enquanto nenhuma alteração foi vista
+  private advanceCursor(conversationId: string, seq: number, changeSeq: number) {
+    const entries = new Map<string, [number, number]>()
+    for (const part of (localStorage.getItem('wsCursor') || '').split(',')) {
+      const [id, value, change] = part.split(':')
+      if (id && value) entries.set(id, [Number(value), Number(change || 0)])
+    }
+
+    const [currentSeq, currentChange] = entries.get(conversationId) ?? [0, 0]
+    if (currentSeq >= seq && currentChange >= changeSeq) return
+    entries.set(conversationId, [Math.max(currentSeq, seq), Math.max(currentChange, changeSeq)])
+
+    const cursor = [...entries.keys()].sort().map(id => {
+      const [value, change] = entries.get(id)!
+      return change > 0 ? `${id}:${value}:${change}` : `${id}:${value}`
+    }).join(',')
+    localStorage.setItem('wsCursor', cursor)
+  }
+
   private handleReconnect(userId: string) {
     if (this.currentAttempts >= this.maxAttempts) return
 
@@ -174,15 +314,10 @@ export class WebSocketService {
     this.conversationUpdateHandlers.forEach(handler => handler())
   }
 
-  sendMessage(conversationId: string, content: string, participants: any[]) {
-    if (!this.ws || this.ws.readyState !== WebSocket.OPEN) {
-      throw new Error('WebSocket não está conectado')
-    }
-
+  sendMessage(conversationId: string, content: string, participants: any[], clientMessageId: string = crypto.randomUUID()): Promise<AckPayload> {
     console.log('Enviando mensagem:', {
       conversationId,
-      participants,
-      wsState: this.ws.readyState
+      participants
     })
 
     const elgamal = new ElGamal()
@@ -194,16 +329,12 @@ export class WebSocketService {
       encryptedContents[participant.id] = encrypted
     }
 
-    const message = {
-      type: 'message',
-      payload: {
-        conversationId,
-        encryptedContents
-      }
-    }
-
-    console.log('Enviando mensagem WebSocket:', message)
-    this.ws.send(JSON.stringify(message))
+    // Reenviar com a mesma chave não duplica a mensagem no servidor
+    return this.request('message', {
+      conversationId,
+      encryptedContents,
+      clientMessageId
+    })
   }
 }
 
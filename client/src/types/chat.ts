@@ -30,6 +30,7 @@ export interface ConversationDetails {
 export interface Message {
   id?: string
   conversationId: string
+  seq?: number // Posição na conversa; define a ordem das mensagens
   senderId: string
   content: {
     a: string
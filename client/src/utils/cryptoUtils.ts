@@ -13,43 +13,85 @@ const getCryptoAPI = () => {
 // Acessa a API de criptografia
 const cryptoAPI = getCryptoAPI();
 
+// Registro que descreve como a chave privada foi cifrada; deve acompanhar server/crypto/keywrap
+export interface KeyWrapParams {
+  version: number
+  kdf: 'pbkdf2-sha256' | 'argon2id'
+  salt: string
+  iterations: number
+  memory?: number
+  parallelism?: number
+  cipher: 'aes-256-gcm'
+}
+
+export const KEY_WRAP_VERSION = 2;
+const PBKDF2_ITERATIONS = 600000;
+const SALT_BYTES = 16;
+
 /**
- * Criptografa a chave privada usando a senha do usuário.
- * Utiliza AES-256-GCM para criptografia simétrica.
- *
- * @param privateKey A chave privada a ser criptografada.
- * @param password A senha do usuário para derivar a chave de criptografia.
- * @returns Uma string base64 contendo o IV e os dados criptografados.
+ * Gera os parâmetros de uma nova cifragem da chave privada, com salt aleatório.
+ */
+export const createKeyWrapParams = (): KeyWrapParams => ({
+  version: KEY_WRAP_VERSION,
+  kdf: 'pbkdf2-sha256',
+  salt: bufferToBase64(cryptoAPI.getRandomValues(new Uint8Array(SALT_BYTES))),
+  iterations: PBKDF2_ITERATIONS,
+  cipher: 'aes-256-gcm',
+});
+
+/**
+ * Deriva a chave AES-GCM a partir da senha com os parâmetros do registro.
  */
-export const encryptPrivateKey = async (privateKey: PrivateKey, password: string): Promise<string> => {
-  const encoder = new TextEncoder();
-  const passwordBytes = encoder.encode(password);
+const deriveWrappingKey = async (
+  password: string,
+  params: KeyWrapParams,
+  usage: 'encrypt' | 'decrypt'
+): Promise<CryptoKey> => {
+  if (params.kdf !== 'pbkdf2-sha256' || params.cipher !== 'aes-256-gcm') {
+    throw new Error(`Parâmetros de chave não suportados: ${params.kdf}/${params.cipher}`);
+  }
 
-  // Derivar uma chave a partir da senha usando PBKDF2
   const keyMaterial = await cryptoAPI.subtle.importKey(
     'raw',
-    passwordBytes,
+    new TextEncoder().encode(password),
     'PBKDF2',
     false,
     ['deriveKey']
   );
 
-  const key = await cryptoAPI.subtle.deriveKey(
+  return cryptoAPI.subtle.deriveKey(
     {
       name: 'PBKDF2',
-      salt: encoder.encode('unique-salt'), // Utilize um salt único e armazenado de forma segura
-      iterations: 100000,
+      salt: base64ToBuffer(params.salt),
+      iterations: params.iterations,
       hash: 'SHA-256',
     },
     keyMaterial,
     { name: 'AES-GCM', length: 256 },
-    true,
-    ['encrypt']
+    false,
+    [usage]
   );
+};
+
+/**
+ * Criptografa a chave privada usando a senha do usuário.
+ * Utiliza AES-256-GCM com a chave derivada conforme os parâmetros.
+ *
+ * @param privateKey A chave privada a ser criptografada.
+ * @param password A senha do usuário para derivar a chave de criptografia.
+ * @param params Os parâmetros de derivação, gerados por createKeyWrapParams.
+ * @returns Uma string base64 contendo o IV e os dados criptografados.
+ */
+export const encryptPrivateKey = async (
+  privateKey: PrivateKey,
+  password: string,
+  params: KeyWrapParams
+): Promise<string> => {
+  const key = await deriveWrappingKey(password, params, 'encrypt');
 
   // Criptografar a chave privada
   const iv = cryptoAPI.getRandomValues(new Uint8Array(12)); // IV de 96 bits para AES-GCM
-  const encodedPrivateKey = encoder.encode(privateKey.x);
+  const encodedPrivateKey = new TextEncoder().encode(privateKey.x);
   const encrypted = await cryptoAPI.subtle.encrypt(
     {
       name: 'AES-GCM',
@@ -73,40 +115,21 @@ export const encryptPrivateKey = async (privateKey: PrivateKey, password: string
  *
  * @param encryptedData A string base64 contendo o IV e os dados criptografados.
  * @param password A senha do usuário para derivar a chave de descriptografia.
+ * @param params Os parâmetros com que a chave foi criptografada, retornados pelo servidor.
  * @returns A chave privada descriptografada.
  */
-export const decryptPrivateKey = async (encryptedData: string, password: string): Promise<PrivateKey> => {
-  const decoder = new TextDecoder();
+export const decryptPrivateKey = async (
+  encryptedData: string,
+  password: string,
+  params: KeyWrapParams
+): Promise<PrivateKey> => {
   const combined = base64ToBuffer(encryptedData);
 
   // Extrair IV e dados criptografados
   const iv = combined.slice(0, 12);
   const encrypted = combined.slice(12);
 
-  const encoder = new TextEncoder();
-  const passwordBytes = encoder.encode(password);
-
-  // Derivar a mesma chave a partir da senha usando PBKDF2
-  const keyMaterial = await cryptoAPI.subtle.importKey(
-    'raw',
-    passwordBytes,
-    'PBKDF2',
-    false,
-    ['deriveKey']
-  );
-
-  const key = await cryptoAPI.subtle.deriveKey(
-    {
-      name: 'PBKDF2',
-      salt: encoder.encode('unique-salt'), // O mesmo salt utilizado na criptografia
-      iterations: 100000,
-      hash: 'SHA-256',
-    },
-    keyMaterial,
-    { name: 'AES-GCM', length: 256 },
-    true,
-    ['decrypt']
-  );
+  const key = await deriveWrappingKey(password, params, 'decrypt');
 
   // Descriptografar a chave privada
   const decrypted = await cryptoAPI.subtle.decrypt(
@@ -118,7 +141,7 @@ export const decryptPrivateKey = async (encryptedData: string, password: string)
     encrypted
   );
 
-  const decryptedKey = decoder.decode(new Uint8Array(decrypted));
+  const decryptedKey = new TextDecoder().decode(new Uint8Array(decrypted));
   return { x: decryptedKey };
 };
 
@@ -86,9 +86,10 @@ export class ElGamal {
    *
    * @param message A mensagem a ser criptografada.
    * @param receiverPublicKey A chave pública do receptor.
+   * @param nonce Valor fixo de k, usado apenas para reproduzir os vetores de teste.
    * @returns Um objeto EncryptedMessage contendo 'a', 'b' e 'p'.
    */
-  encrypt(message: string, publicKey: PublicKey): EncryptedMessage {
+  encrypt(message: string, publicKey: PublicKey, nonce?: string): EncryptedMessage {
     try {
       if (!publicKey.p || !publicKey.g || !publicKey.y) {
         throw new Error('Chave pública inválida: faltam propriedades necessárias');
@@ -99,7 +100,7 @@ export class ElGamal {
       const g = BigInt(publicKey.g);
       const y = BigInt(publicKey.y);
 
-      const k = this.generateSecureRandomBigInt(2n, p - 2n);
+      const k = nonce !== undefined ? BigInt(nonce) : this.generateSecureRandomBigInt(2n, p - 2n);
       const a = this.modularExponentiation(g, k, p);
       const s = this.modularExponentiation(y, k, p);
       const m = this.stringToBigInt(message);
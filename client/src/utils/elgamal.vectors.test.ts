@@ -0,0 +1,37 @@
+import * as fs from 'fs';
+import * as path from 'path';
+import { ElGamal } from './elgamal';
+
+// Vetores compartilhados com a implementação Go em server/crypto/elgamal
+const vectorsPath = path.resolve(__dirname, '../../../server/crypto/elgamal/testdata/vectors.json');
+
+interface Vector {
+  name: string;
+  p: string;
+  g: string;
+  y: string;
+  x: string;
+  k: string;
+  message: string;
+  m: string;
+  a: string;
+  b: string;
+}
+
+const { vectors } = JSON.parse(fs.readFileSync(vectorsPath, 'utf-8')) as { vectors: Vector[] };
+
+describe('ElGamal - vetores compartilhados com o servidor', () => {
+  const elgamal = new ElGamal();
+
+  test.each(vectors.map(v => [v.name, v] as const))('Criptografia determinística (%s)', (_, v) => {
+    const encrypted = elgamal.encrypt(v.message, { p: v.p, g: v.g, y: v.y }, v.k);
+
+    expect(encrypted).toEqual({ a: v.a, b: v.b, p: v.p });
+  });
+
+  test.each(vectors.map(v => [v.name, v] as const))('Descriptografia (%s)', (_, v) => {
+    const decrypted = elgamal.decrypt({ a: v.a, b: v.b, p: v.p }, { x: v.x });
+
+    expect(decrypted).toBe(v.message);
+  });
+});
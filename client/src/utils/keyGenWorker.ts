@@ -1,6 +1,6 @@
 // Este arquivo será executado em um Web Worker
 import { ElGamal } from './elgamal';
-import { encryptPrivateKey } from './cryptoUtils';
+import { createKeyWrapParams, encryptPrivateKey } from './cryptoUtils';
 
 // Define explicitamente o escopo self para o contexto do Worker
 const workerScope = self as unknown as Worker;
@@ -17,8 +17,9 @@ workerScope.onmessage = async (e) => {
       const { publicKey, privateKey } = elgamal;
 
       console.log('Worker: chaves geradas, iniciando criptografia');
-      // Criptografa a chave privada com a senha fornecida
-      const encryptedPrivateKey = await encryptPrivateKey(privateKey, password);
+      // Criptografa a chave privada com a senha fornecida e um salt novo
+      const keyWrap = createKeyWrapParams();
+      const encryptedPrivateKey = await encryptPrivateKey(privateKey, password, keyWrap);
 
       console.log('Worker: processo concluído, enviando resposta');
       // Envia as chaves de volta para o thread principal
@@ -27,7 +28,8 @@ workerScope.onmessage = async (e) => {
         data: {
           publicKey,
           privateKey,
-          encryptedPrivateKey
+          encryptedPrivateKey,
+          keyWrap
         }
       });
     }
@@ -0,0 +1,65 @@
+// Ferramenta administrativa do servidor. Deve ser executada no diretório do banco:
+//
+//	go run ./cmd/admin reset-2fa <username>
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"server/config"
+	"server/models"
+	"server/services"
+)
+
+const usage = `uso: admin <comando> [argumentos]
+
+comandos:
+  reset-2fa <username>   desativa a autenticação em dois fatores e apaga os códigos de recuperação
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "reset-2fa":
+		if len(os.Args) != 3 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		if err := resetTwoFactor(os.Args[2]); err != nil {
+			fmt.Fprintln(os.Stderr, "Erro:", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// resetTwoFactor remove o segundo fator de um usuário que perdeu o autenticador e os códigos
+func resetTwoFactor(username string) error {
+	config.InitDatabase()
+
+	var user models.User
+	result := config.DB.Select("id", "totp_enabled").Where("username = ?", username).Limit(1).Find(&user)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("usuário %q não encontrado", username)
+	}
+	if !user.TOTPEnabled {
+		fmt.Printf("Usuário %s não tem autenticação em dois fatores ativa\n", username)
+		return nil
+	}
+
+	if err := services.ResetTwoFactor(user.ID); err != nil {
+		return err
+	}
+	fmt.Printf("Autenticação em dois fatores de %s desativada\n", username)
+	return nil
+}
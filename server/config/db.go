@@ -1,7 +1,10 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
+	"server/crypto/keywrap"
 	"server/models"
 
 	"gorm.io/driver/sqlite"
@@ -17,17 +20,77 @@ func InitDatabase() {
 		log.Fatal("Falha ao conectar ao banco de dados:", err)
 	}
 
+	if err := Migrate(DB); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Migrate cria ou atualiza os esquemas e converte os dados de versões anteriores
+func Migrate(db *gorm.DB) error {
 	// Migrar os esquemas
-	err = DB.AutoMigrate(
+	err := db.AutoMigrate(
 		&models.User{},
+		&models.Device{},
+		&models.Session{},
+		&models.RecoveryCode{},
 		&models.Contact{},
 		&models.Group{},
+		&models.GroupEpoch{},
+		&models.SenderKeyDistribution{},
 		&models.Conversation{},
 		&models.Message{},
 		&models.ConversationParticipant{},
 		&models.MessageRecipient{},
 	)
 	if err != nil {
-		log.Fatal("Falha ao migrar o banco de dados:", err)
+		return fmt.Errorf("falha ao migrar o banco de dados: %w", err)
+	}
+
+	// Grupos criados antes dos papéis: o administrador original passa a ser o dono
+	err = db.Exec(`
+		UPDATE conversation_participants SET role = ?
+		WHERE role = ? AND EXISTS (
+			SELECT 1 FROM groups g
+			WHERE g.conversation_id = conversation_participants.conversation_id
+			AND g.admin_id = conversation_participants.user_id
+		)`, models.RoleOwner, models.RoleMember).Error
+	if err != nil {
+		return fmt.Errorf("falha ao migrar os papéis dos grupos: %w", err)
+	}
+
+	// Mensagens criadas antes das sequências são numeradas pela ordem de criação
+	err = db.Exec(`
+		UPDATE messages SET seq = (
+			SELECT r.n FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY conversation_id ORDER BY created_at, id) AS n
+				FROM messages
+			) r WHERE r.id = messages.id
+		)
+		WHERE NOT EXISTS (SELECT 1 FROM messages WHERE seq > 0)`).Error
+	if err == nil {
+		err = db.Exec(`
+			UPDATE conversations SET last_seq = (
+				SELECT COALESCE(MAX(seq), 0) FROM messages WHERE messages.conversation_id = conversations.id
+			)
+			WHERE last_seq = 0`).Error
+	}
+	if err == nil {
+		err = db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_conversation_seq ON messages (conversation_id, seq)").Error
+	}
+	if err == nil {
+		err = db.Exec("CREATE INDEX IF NOT EXISTS idx_conversation_change_seq ON messages (conversation_id, change_seq)").Error
+	}
+	if err != nil {
+		return fmt.Errorf("falha ao migrar as sequências das mensagens: %w", err)
+	}
+
+	// Chaves privadas cifradas antes do salt por usuário usam os parâmetros fixos do cliente
+	legacyWrap, err := json.Marshal(keywrap.Legacy())
+	if err == nil {
+		err = db.Exec("UPDATE users SET key_wrap = ? WHERE key_wrap IS NULL OR key_wrap = ''", string(legacyWrap)).Error
+	}
+	if err != nil {
+		return fmt.Errorf("falha ao migrar os parâmetros das chaves privadas: %w", err)
 	}
+	return nil
 }
\ No newline at end of file
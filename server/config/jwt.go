@@ -1,4 +1,213 @@
 // server/config/jwt.go
 package config
 
-var JWTSecret = []byte("sua_chave_secreta_aqui") // Certifique-se de usar uma chave segura e consistente
\ No newline at end of file
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// MinJWTSecretLength é o tamanho mínimo, em bytes, de um segredo HS256
+const MinJWTSecretLength = 32
+
+// Valores padrão das claims iss e aud, usados quando JWT_ISSUER e JWT_AUDIENCE não são definidos
+const (
+	DefaultJWTIssuer   = "chat-e2ee"
+	DefaultJWTAudience = "chat-e2ee-api"
+)
+
+// JWTKey é uma chave de assinatura de tokens, identificada pelo kid do cabeçalho
+type JWTKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   interface{} // nil em chaves aposentadas, aceitas apenas na verificação
+	VerifyKey interface{}
+}
+
+// JWTKeySet reúne as chaves aceitas e a chave usada para assinar novos tokens
+type JWTKeySet struct {
+	Issuer   string
+	Audience string
+	Active   *JWTKey
+	Keys     map[string]*JWTKey
+}
+
+// JWT é o conjunto de chaves carregado por InitJWT
+var JWT *JWTKeySet
+
+// jwtKeyConfig é o formato de JWT_KEYS e do arquivo apontado por JWT_KEYS_FILE
+type jwtKeyConfig struct {
+	ActiveKid string        `json:"activeKid"`
+	Keys      []jwtKeyEntry `json:"keys"`
+}
+
+type jwtKeyEntry struct {
+	Kid        string `json:"kid"`
+	Alg        string `json:"alg"`
+	Secret     string `json:"secret"`     // HS256
+	PrivateKey string `json:"privateKey"` // PEM, EdDSA ou ES256
+	PublicKey  string `json:"publicKey"`  // PEM, para chaves que só verificam
+}
+
+// InitJWT carrega as chaves de assinatura dos tokens, encerrando o servidor se forem inválidas
+func InitJWT() {
+	keys, err := LoadJWTKeys()
+	if err != nil {
+		log.Fatal("Falha ao carregar as chaves JWT:", err)
+	}
+	JWT = keys
+}
+
+// LoadJWTKeys lê as chaves de JWT_KEYS_FILE, JWT_KEYS ou JWT_SECRET, nessa ordem. Sem
+// nenhuma delas, gera uma chave temporária: os tokens deixam de valer quando o servidor reinicia.
+func LoadJWTKeys() (*JWTKeySet, error) {
+	var cfg jwtKeyConfig
+
+	if path := os.Getenv("JWT_KEYS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	} else if raw := os.Getenv("JWT_KEYS"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+			return nil, fmt.Errorf("JWT_KEYS: %w", err)
+		}
+	} else {
+		secret := os.Getenv("JWT_SECRET")
+		kid := os.Getenv("JWT_KID")
+		if kid == "" {
+			kid = "default"
+		}
+		if secret == "" {
+			raw := make([]byte, MinJWTSecretLength)
+			if _, err := rand.Read(raw); err != nil {
+				return nil, err
+			}
+			secret = hex.EncodeToString(raw)
+			kid = "temp-" + secret[:8]
+			log.Println("Aviso: nenhuma chave JWT configurada; usando uma chave temporária")
+		}
+		cfg.ActiveKid = kid
+		cfg.Keys = []jwtKeyEntry{{Kid: kid, Alg: "HS256", Secret: secret}}
+	}
+
+	set := &JWTKeySet{
+		Issuer:   envOrDefault("JWT_ISSUER", DefaultJWTIssuer),
+		Audience: envOrDefault("JWT_AUDIENCE", DefaultJWTAudience),
+		Keys:     make(map[string]*JWTKey, len(cfg.Keys)),
+	}
+
+	for _, entry := range cfg.Keys {
+		if entry.Kid == "" {
+			return nil, errors.New("toda chave precisa de um kid")
+		}
+		if _, exists := set.Keys[entry.Kid]; exists {
+			return nil, fmt.Errorf("kid %q repetido", entry.Kid)
+		}
+
+		key, err := parseJWTKey(entry)
+		if err != nil {
+			return nil, fmt.Errorf("chave %q: %w", entry.Kid, err)
+		}
+		set.Keys[entry.Kid] = key
+	}
+
+	// Com uma única chave, ela é a ativa mesmo sem activeKid
+	activeKid := cfg.ActiveKid
+	if activeKid == "" && len(cfg.Keys) == 1 {
+		activeKid = cfg.Keys[0].Kid
+	}
+	active, ok := set.Keys[activeKid]
+	if !ok {
+		return nil, fmt.Errorf("chave ativa %q não encontrada", activeKid)
+	}
+	if active.SignKey == nil {
+		return nil, fmt.Errorf("chave ativa %q não tem chave privada", activeKid)
+	}
+	set.Active = active
+
+	return set, nil
+}
+
+// parseJWTKey valida o algoritmo e decodifica o material da chave
+func parseJWTKey(entry jwtKeyEntry) (*JWTKey, error) {
+	key := &JWTKey{ID: entry.Kid}
+	secret, privatePEM, publicPEM := entry.Secret, entry.PrivateKey, entry.PublicKey
+
+	switch entry.Alg {
+	case "HS256":
+		if len(secret) < MinJWTSecretLength {
+			return nil, fmt.Errorf("o segredo HS256 deve ter ao menos %d bytes", MinJWTSecretLength)
+		}
+		key.Method = jwt.SigningMethodHS256
+		key.SignKey = []byte(secret)
+		key.VerifyKey = []byte(secret)
+
+	case "EdDSA":
+		key.Method = jwt.SigningMethodEdDSA
+		if privatePEM != "" {
+			private, err := jwt.ParseEdPrivateKeyFromPEM([]byte(privatePEM))
+			if err != nil {
+				return nil, err
+			}
+			key.SignKey = private
+			key.VerifyKey = private.(ed25519.PrivateKey).Public()
+		} else if publicPEM != "" {
+			public, err := jwt.ParseEdPublicKeyFromPEM([]byte(publicPEM))
+			if err != nil {
+				return nil, err
+			}
+			key.VerifyKey = public
+		}
+
+	case "ES256":
+		key.Method = jwt.SigningMethodES256
+		var public *ecdsa.PublicKey
+		if privatePEM != "" {
+			private, err := jwt.ParseECPrivateKeyFromPEM([]byte(privatePEM))
+			if err != nil {
+				return nil, err
+			}
+			key.SignKey = private
+			public = &private.PublicKey
+		} else if publicPEM != "" {
+			var err error
+			if public, err = jwt.ParseECPublicKeyFromPEM([]byte(publicPEM)); err != nil {
+				return nil, err
+			}
+		}
+		if public != nil {
+			if public.Curve != elliptic.P256() {
+				return nil, errors.New("ES256 exige uma chave da curva P-256")
+			}
+			key.VerifyKey = public
+		}
+
+	default:
+		return nil, fmt.Errorf("algoritmo %q não suportado; use HS256, EdDSA ou ES256", entry.Alg)
+	}
+
+	if key.VerifyKey == nil {
+		return nil, errors.New("informe privateKey ou publicKey")
+	}
+	return key, nil
+}
+
+func envOrDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
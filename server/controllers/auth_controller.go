@@ -1,13 +1,16 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"server/config"
+	"server/crypto/keywrap"
 	"server/models"
 	"server/services"
 	"server/utils"
+	"server/websocket"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
@@ -15,9 +18,10 @@ import (
 
 // RegisterRequest representa a payload para registro de usuário
 type RegisterRequest struct {
-	Username            string              `json:"username" binding:"required"`
-	Password            string              `json:"password" binding:"required"`
-	EncryptedPrivateKey string              `json:"encryptedPrivateKey" binding:"required"`
+	Username            string               `json:"username" binding:"required"`
+	Password            string               `json:"password" binding:"required"`
+	EncryptedPrivateKey string               `json:"encryptedPrivateKey" binding:"required"`
+	KeyWrap             *keywrap.Params      `json:"keyWrap" binding:"required"`
 	PublicKey           models.PublicKeyData `json:"publicKey" binding:"required"`
 }
 
@@ -29,6 +33,14 @@ func RegisterUser(c *gin.Context) {
 		return
 	}
 
+	// Validar a chave pública antes de persistir
+	if !validatePublicKey(c, "publicKey", req.PublicKey) {
+		return
+	}
+	if !validateKeyWrap(c, "keyWrap", *req.KeyWrap) {
+		return
+	}
+
 	// Verificar se o usuário já existe
 	var existingUser models.User
 	if err := config.DB.Where("username = ?", req.Username).First(&existingUser).Error; err == nil {
@@ -49,6 +61,7 @@ func RegisterUser(c *gin.Context) {
 		Username:            req.Username,
 		PasswordHash:        string(hashedPassword),
 		EncryptedPrivateKey: req.EncryptedPrivateKey,
+		KeyWrap:             *req.KeyWrap,
 		PublicKey:           req.PublicKey,
 		CreatedAt:           time.Now(),
 		LastSeen:            time.Now(),
@@ -59,22 +72,14 @@ func RegisterUser(c *gin.Context) {
 		return
 	}
 
-	// Gerar token JWT
-	token, err := services.GenerateJWT(user.ID)
+	// Abrir a sessão do novo usuário
+	tokens, err := services.CreateSession(user.ID, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar token"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"token":               token,
-		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-		},
-		"publicKey":           user.PublicKey,
-		"encryptedPrivateKey": user.EncryptedPrivateKey,
-	})
+	c.JSON(http.StatusCreated, sessionResponse(tokens, user))
 }
 
 // LoginRequest representa a payload para login de usuário
@@ -105,31 +110,167 @@ func LoginUser(c *gin.Context) {
 		return
 	}
 
-	// Gerar o token JWT
-	token, err := services.GenerateJWT(user.ID)
+	// Com dois fatores ativos, a sessão só é aberta após o código em /auth/login/2fa
+	if user.TOTPEnabled {
+		challenge, expiresAt, err := services.IssueLoginChallenge(user.ID)
+		if errors.Is(err, services.ErrTwoFactorLocked) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao iniciar login"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"twoFactorRequired":  true,
+			"challengeToken":     challenge,
+			"challengeExpiresAt": expiresAt,
+		})
+		return
+	}
+
+	// Abrir uma sessão para este dispositivo
+	tokens, err := services.CreateSession(user.ID, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
+	c.JSON(http.StatusOK, sessionResponse(tokens, user))
+}
+
+// sessionResponse monta a resposta de uma sessão aberta, com o material de chaves do usuário
+func sessionResponse(tokens *services.SessionTokens, user models.User) gin.H {
+	return gin.H{
+		"token":        tokens.AccessToken,
+		"expiresAt":    tokens.AccessTokenExpiresAt,
+		"refreshToken": tokens.RefreshToken,
+		"sessionId":    tokens.SessionID,
 		"user": gin.H{
 			"id":       user.ID,
 			"username": user.Username,
 		},
 		"publicKey":           user.PublicKey,
 		"encryptedPrivateKey": user.EncryptedPrivateKey,
+		"keyWrap":             user.KeyWrap,
+	}
+}
+
+// RefreshTokenRequest representa a payload com o refresh token da sessão
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// RefreshToken troca o refresh token por um novo access token e um novo refresh token
+func RefreshToken(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, revoked, err := services.RefreshSession(req.RefreshToken)
+	if errors.Is(err, services.ErrInvalidRefreshToken) {
+		// Um refresh token reutilizado revoga a sessão; suas conexões também são encerradas
+		if revoked != nil {
+			websocket.GetHub().DisconnectSession(revoked.UserID, revoked.ID)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao renovar sessão"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":        tokens.AccessToken,
+		"expiresAt":    tokens.AccessTokenExpiresAt,
+		"refreshToken": tokens.RefreshToken,
+		"sessionId":    tokens.SessionID,
 	})
 }
 
-// UpdateKeysRequest representa a payload para atualizar as chaves do usuário
+// Logout encerra a sessão do refresh token e desconecta seus WebSockets
+func Logout(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := services.RevokeSessionByRefreshToken(req.RefreshToken)
+	if errors.Is(err, services.ErrInvalidRefreshToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao encerrar sessão"})
+		return
+	}
+
+	websocket.GetHub().DisconnectSession(session.UserID, session.ID)
+
+	c.Status(http.StatusNoContent)
+}
+
+// ChangePasswordRequest representa a payload para troca de senha. A chave privada vem
+// recifrada pelo cliente com a nova senha e um novo salt.
+type ChangePasswordRequest struct {
+	OldPassword         string          `json:"oldPassword" binding:"required"`
+	NewPassword         string          `json:"newPassword" binding:"required"`
+	EncryptedPrivateKey string          `json:"encryptedPrivateKey" binding:"required"`
+	KeyWrap             *keywrap.Params `json:"keyWrap" binding:"required"`
+}
+
+// ChangePassword troca a senha do usuário e encerra suas outras sessões
+func ChangePassword(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !validateKeyWrap(c, "keyWrap", *req.KeyWrap) {
+		return
+	}
+
+	revoked, err := services.ChangePassword(userID, c.GetString("session_id"), req.OldPassword, req.NewPassword, req.EncryptedPrivateKey, *req.KeyWrap)
+	if errors.Is(err, services.ErrWrongPassword) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao trocar senha"})
+		return
+	}
+
+	hub := websocket.GetHub()
+	for _, sessionID := range revoked {
+		hub.DisconnectSession(userID, sessionID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revokedSessions": len(revoked)})
+}
+
+// UpdateKeysRequest representa a payload para trocar o par de chaves ou recifrar a chave
+// privada de uma conta legada
 type UpdateKeysRequest struct {
-	EncryptedPrivateKey string              `json:"encrypted_private_key" binding:"required"`
-	PublicKey           models.PublicKeyData `json:"publicKey" binding:"required"` // Alterado para "publicKey"
+	CurrentPassword     string                `json:"currentPassword" binding:"required"`
+	EncryptedPrivateKey string                `json:"encryptedPrivateKey" binding:"required"`
+	KeyWrap             *keywrap.Params       `json:"keyWrap" binding:"required"`
+	PublicKey           *models.PublicKeyData `json:"publicKey"` // Ausente apenas recifra a chave privada atual
 }
 
-// UpdateKeys atualiza as chaves do usuário
+// UpdateKeys troca o par de chaves do usuário ou, sem publicKey, recifra a chave privada de uma
+// conta que ainda usa os parâmetros legados. Contas já migradas trocam a cifragem da chave atual
+// apenas com a troca de senha.
 func UpdateKeys(c *gin.Context) {
 	userID, err := utils.GetUserIDFromContext(c)
 	if err != nil {
@@ -143,13 +284,26 @@ func UpdateKeys(c *gin.Context) {
 		return
 	}
 
-	// Atualizar as chaves no banco de dados
-	if err := config.DB.Model(&models.User{}).
-		Where("id = ?", userID).
-		Updates(map[string]interface{}{
-			"encrypted_private_key": req.EncryptedPrivateKey,
-			"publicKey":           req.PublicKey,
-		}).Error; err != nil {
+	if req.PublicKey != nil && !validatePublicKey(c, "publicKey", *req.PublicKey) {
+		return
+	}
+	if !validateKeyWrap(c, "keyWrap", *req.KeyWrap) {
+		return
+	}
+
+	err = services.UpdateKeys(userID, req.CurrentPassword, services.KeyUpdate{
+		EncryptedPrivateKey: req.EncryptedPrivateKey,
+		KeyWrap:             *req.KeyWrap,
+		PublicKey:           req.PublicKey,
+	})
+	switch {
+	case errors.Is(err, services.ErrWrongPassword):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrKeyWrapUpToDate):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar chaves"})
 		return
 	}
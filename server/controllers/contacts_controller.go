@@ -6,7 +6,9 @@ import (
 
 	"server/config"
 	"server/models"
+	"server/services"
 	"server/utils"
+	"server/websocket"
 
 	"github.com/gin-gonic/gin"
 )
@@ -41,6 +43,8 @@ func ListContacts(c *gin.Context) {
 			"username":   contact.Contact.Username,
 			"added_at":   contact.AddedAt,
 			"publicKey": contact.Contact.PublicKey,
+			"online":     websocket.GetHub().IsOnline(contact.ContactID),
+			"lastSeen":   services.VisibleLastSeen(contact.Contact),
 		})
 	}
 
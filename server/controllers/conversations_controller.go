@@ -2,12 +2,16 @@ package controllers
 
 import (
 	"database/sql"
-	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"server/config"
+	"server/crypto/elgamal"
 	"server/models"
+	"server/services"
 	"server/utils"
 	"server/websocket"
 
@@ -22,7 +26,18 @@ type CreateConversationRequest struct {
 
 // SendMessageRequest representa a payload para enviar uma mensagem
 type SendMessageRequest struct {
-	EncryptedContents map[string]models.ElGamalContent `json:"encryptedContents" binding:"required"`
+	EncryptedContents       map[string]models.ElGamalContent `json:"encryptedContents"`
+	DeviceEncryptedContents map[string]models.ElGamalContent `json:"deviceEncryptedContents"`
+	Epoch                   *int64                           `json:"epoch"`
+	SenderKeyContent        *models.SenderKeyContent         `json:"senderKeyContent"`
+	ClientMessageID         string                           `json:"clientMessageId"` // Chave de idempotência para reenvios
+}
+
+// EditMessageRequest representa a payload com os novos conteúdos de uma mensagem
+type EditMessageRequest struct {
+	EncryptedContents       map[string]models.ElGamalContent `json:"encryptedContents"`
+	DeviceEncryptedContents map[string]models.ElGamalContent `json:"deviceEncryptedContents"`
+	SenderKeyContent        *models.SenderKeyContent         `json:"senderKeyContent"`
 }
 
 type ConversationResponse struct {
@@ -42,11 +57,6 @@ func ListConversations(c *gin.Context) {
 	}
 
 	query := `
-		WITH LatestMessage AS (
-			SELECT conversation_id, MAX(created_at) as max_date
-			FROM messages
-			GROUP BY conversation_id
-		)
 		SELECT DISTINCT
 			c.id,
 			c.type,
@@ -55,12 +65,12 @@ func ListConversations(c *gin.Context) {
 				ELSE u.username
 			END as name,
 			(
-				SELECT COUNT(*)
+				SELECT COUNT(DISTINCT msg.id)
 				FROM messages msg
 				JOIN message_recipients mrec ON mrec.message_id = msg.id
 				WHERE msg.conversation_id = c.id
 				AND mrec.recipient_id = @user_id
-				AND mrec.status = 'SENT'
+				AND mrec.status <> 'READ'
 				AND msg.sender_id != @user_id
 			) as unread_count,
 			datetime(COALESCE(m.created_at, c.created_at)) as updated_at
@@ -69,8 +79,7 @@ func ListConversations(c *gin.Context) {
 		LEFT JOIN groups g ON g.conversation_id = c.id
 		LEFT JOIN conversation_participants cp2 ON cp2.conversation_id = c.id AND cp2.user_id != @user_id
 		LEFT JOIN users u ON u.id = cp2.user_id AND c.type = 'DIRECT'
-		LEFT JOIN LatestMessage lm ON lm.conversation_id = c.id
-		LEFT JOIN messages m ON m.conversation_id = c.id AND m.created_at = lm.max_date
+		LEFT JOIN messages m ON m.conversation_id = c.id AND m.seq = c.last_seq
 		ORDER BY updated_at DESC`
 
 	var conversations []ConversationResponse
@@ -97,12 +106,14 @@ func GetConversation(c *gin.Context) {
 
 	conversationID := c.Param("id")
 	includeMessages := c.Query("include_messages") == "true"
+	deviceID := c.Query("device_id")
 
 	var conversation models.Conversation
 	query := config.DB.
 		Preload("Participants.User").
+		Preload("Participants.User.Devices", "revoked_at IS NULL").
 		Preload("Messages", func(db *gorm.DB) *gorm.DB {
-			return db.Order("created_at DESC")
+			return db.Where("expires_at IS NULL OR expires_at > ?", time.Now()).Order("seq DESC")
 		}).
 		Preload("Messages.Recipients", "recipient_id = ?", userID).
 		Preload("Messages.Sender")
@@ -112,12 +123,20 @@ func GetConversation(c *gin.Context) {
 		return
 	}
 
+	epoch, err := services.CurrentEpoch(conversation.ID, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar grupo"})
+		return
+	}
+
 	// Converter para DTO
 	dto := models.ConversationDTO{
-		ID:           conversation.ID,
-		Type:         conversation.Type,
-		CreatedAt:    conversation.CreatedAt,
-		Participants: make([]models.ParticipantDTO, 0),
+		ID:                  conversation.ID,
+		Type:                conversation.Type,
+		CreatedAt:           conversation.CreatedAt,
+		Epoch:               epoch,
+		DisappearingSeconds: conversation.DisappearingSeconds,
+		Participants:        make([]models.ParticipantDTO, 0),
 	}
 
 	// Definir o nome da conversa
@@ -135,10 +154,21 @@ func GetConversation(c *gin.Context) {
 
 	// Converter participantes
 	for _, p := range conversation.Participants {
+		devices := make([]models.DeviceDTO, 0, len(p.User.Devices))
+		for _, d := range p.User.Devices {
+			devices = append(devices, models.DeviceDTO{
+				ID:        d.ID,
+				Name:      d.Name,
+				PublicKey: d.PublicKey,
+			})
+		}
+
 		dto.Participants = append(dto.Participants, models.ParticipantDTO{
 			ID:        p.User.ID,
 			Username:  p.User.Username,
 			PublicKey: p.User.PublicKey,
+			Role:      p.Role,
+			Devices:   devices,
 		})
 	}
 
@@ -146,17 +176,24 @@ func GetConversation(c *gin.Context) {
 	if includeMessages {
 		dto.Messages = make([]models.MessageDTO, 0)
 		for _, m := range conversation.Messages {
-			for _, r := range m.Recipients {
-				if r.RecipientID == userID {
-					dto.Messages = append(dto.Messages, models.MessageDTO{
-						ID:        m.ID,
-						SenderID:  m.SenderID,
-						CreatedAt: m.CreatedAt,
-						Content:   r.EncryptedContent,
-						Status:    r.Status,
-					})
-					break
-				}
+			if r, ok := selectRecipient(m.Recipients, deviceID); ok {
+				dto.Messages = append(dto.Messages, models.MessageDTO{
+					ID:               m.ID,
+					Seq:              m.Seq,
+					SenderID:         m.SenderID,
+					ClientMessageID:  m.ClientMessageID,
+					Type:             m.Type,
+					System:           m.System,
+					CreatedAt:        m.CreatedAt,
+					Content:          r.EncryptedContent,
+					Status:           r.Status,
+					Version:          m.Version,
+					Epoch:            m.Epoch,
+					SenderKeyContent: m.SenderKeyContent,
+					EditedAt:         m.EditedAt,
+					DeletedAt:        m.DeletedAt,
+					ExpiresAt:        m.ExpiresAt,
+				})
 			}
 		}
 	}
@@ -165,6 +202,83 @@ func GetConversation(c *gin.Context) {
 	c.JSON(http.StatusOK, dto)
 }
 
+// ListMessages retorna o histórico paginado de uma conversa usando cursores
+func ListMessages(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	before := c.Query("before")
+	after := c.Query("after")
+	if before != "" && after != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use apenas um dos cursores before ou after"})
+		return
+	}
+
+	limit := 0
+	if l := c.Query("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limite inválido"})
+			return
+		}
+	}
+
+	messages, hasMore, err := services.ListMessages(services.MessagePage{
+		ConversationID: c.Param("id"),
+		UserID:         userID,
+		Before:         before,
+		After:          after,
+		Limit:          limit,
+	})
+	if errors.Is(err, services.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar mensagens"})
+		return
+	}
+
+	deviceID := c.Query("device_id")
+	response := make([]models.MessageDTO, 0, len(messages))
+	for _, m := range messages {
+		if r, ok := selectRecipient(m.Recipients, deviceID); ok {
+			response = append(response, models.MessageDTO{
+				ID:               m.ID,
+				Seq:              m.Seq,
+				SenderID:         m.SenderID,
+				ClientMessageID:  m.ClientMessageID,
+				Type:             m.Type,
+				System:           m.System,
+				CreatedAt:        m.CreatedAt,
+				Content:          r.EncryptedContent,
+				Status:           r.Status,
+				Version:          m.Version,
+				Epoch:            m.Epoch,
+				SenderKeyContent: m.SenderKeyContent,
+				EditedAt:         m.EditedAt,
+				DeletedAt:        m.DeletedAt,
+				ExpiresAt:        m.ExpiresAt,
+			})
+		}
+	}
+
+	// O próximo cursor continua na mesma direção a partir do último item da página
+	var nextCursor *string
+	if hasMore && len(messages) > 0 {
+		cursor := services.EncodeSeqCursor(messages[len(messages)-1])
+		nextCursor = &cursor
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messages":   response,
+		"nextCursor": nextCursor,
+	})
+}
+
 // SendMessage envia uma nova mensagem para uma conversa específica
 func SendMessage(c *gin.Context) {
 	userID, err := utils.GetUserIDFromContext(c)
@@ -180,63 +294,176 @@ func SendMessage(c *gin.Context) {
 		return
 	}
 
-	// Iniciar transação
-	tx := config.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
+	// Salvar a mensagem com os conteúdos de cada destinatário e dispositivo
+	message, duplicate, err := services.CreateMessage(services.NewMessageInput{
+		ConversationID:          conversationID,
+		SenderID:                userID,
+		EncryptedContents:       req.EncryptedContents,
+		DeviceEncryptedContents: req.DeviceEncryptedContents,
+		Epoch:                   req.Epoch,
+		SenderKeyContent:        req.SenderKeyContent,
+		ClientMessageID:         req.ClientMessageID,
+	})
+	if err != nil {
+		respondMessageError(c, err)
+		return
+	}
+
+	// Retornar a mensagem criada com o conteúdo específico para o remetente
+	messageDTO := models.MessageDTO{
+		ID:               message.ID,
+		Seq:              message.Seq,
+		SenderID:         userID,
+		ClientMessageID:  message.ClientMessageID,
+		Type:             message.Type,
+		CreatedAt:        message.CreatedAt,
+		Content:          req.EncryptedContents[userID],
+		Status:           models.StatusSent,
+		Version:          message.Version,
+		Epoch:            message.Epoch,
+		SenderKeyContent: message.SenderKeyContent,
+		ExpiresAt:        message.ExpiresAt,
+	}
+
+	// Um reenvio com a mesma chave devolve a mensagem original, sem criar outra
+	if duplicate {
+		if r, ok := selectRecipient(message.Recipients, ""); ok {
+			messageDTO.Content = r.EncryptedContent
+			messageDTO.Status = r.Status
 		}
-	}()
+		c.JSON(http.StatusOK, messageDTO)
+		return
+	}
 
-	// Criar a mensagem
-	message := models.Message{
-		ID:             utils.GenerateUUID(),
-		ConversationID: conversationID,
-		SenderID:       userID,
-		CreatedAt:      time.Now(),
+	c.JSON(http.StatusCreated, messageDTO)
+}
+
+// EditMessage substitui os conteúdos cifrados de uma mensagem enviada pelo usuário
+func EditMessage(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
 	}
 
-	// Salvar a mensagem
-	if err := tx.Create(&message).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar mensagem"})
+	var req EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Salvar os conteúdos criptografados para cada destinatário
-	for recipientID, encryptedContent := range req.EncryptedContents {
-		recipient := models.MessageRecipient{
-			MessageID:        message.ID,
-			RecipientID:     recipientID,
-			EncryptedContent: encryptedContent,
-			Status:           "SENT",
-			StatusUpdatedAt:  time.Now(),
-		}
+	message, err := services.EditMessage(services.EditMessageInput{
+		ConversationID:          c.Param("id"),
+		MessageID:               c.Param("messageId"),
+		SenderID:                userID,
+		EncryptedContents:       req.EncryptedContents,
+		DeviceEncryptedContents: req.DeviceEncryptedContents,
+		SenderKeyContent:        req.SenderKeyContent,
+	})
+	if err != nil {
+		respondMessageError(c, err)
+		return
+	}
 
-		if err := tx.Create(&recipient).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar destinatários"})
-			return
-		}
+	notifyMessageParticipants(message, websocket.GetHub().NotifyMessageEdited)
+
+	c.JSON(http.StatusOK, models.MessageDTO{
+		ID:               message.ID,
+		Seq:              message.Seq,
+		SenderID:         message.SenderID,
+		Type:             message.Type,
+		CreatedAt:        message.CreatedAt,
+		Content:          req.EncryptedContents[userID],
+		Status:           models.StatusSent,
+		Version:          message.Version,
+		Epoch:            message.Epoch,
+		SenderKeyContent: message.SenderKeyContent,
+		EditedAt:         message.EditedAt,
+		ExpiresAt:        message.ExpiresAt,
+	})
+}
+
+// DeleteMessage apaga uma mensagem do usuário para todos os participantes
+func DeleteMessage(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
 	}
 
-	// Commit da transação
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao finalizar transação"})
+	message, err := services.DeleteMessage(c.Param("id"), c.Param("messageId"), userID)
+	if err != nil {
+		respondMessageError(c, err)
 		return
 	}
 
-	// Retornar a mensagem criada com o conteúdo específico para o remetente
-	messageDTO := models.MessageDTO{
+	notifyMessageParticipants(message, websocket.GetHub().NotifyMessageDeleted)
+
+	c.JSON(http.StatusOK, models.MessageDTO{
 		ID:        message.ID,
-		SenderID:  userID,
+		Seq:       message.Seq,
+		SenderID:  message.SenderID,
+		Type:      message.Type,
 		CreatedAt: message.CreatedAt,
-		Content:   req.EncryptedContents[userID],
-		Status:    "SENT",
+		Version:   message.Version,
+		Epoch:     message.Epoch,
+		EditedAt:  message.EditedAt,
+		DeletedAt: message.DeletedAt,
+	})
+}
+
+// SetDisappearingTimer altera o temporizador de mensagens temporárias da conversa
+func SetDisappearingTimer(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusCreated, messageDTO)
+	var req struct {
+		Seconds *int64 `json:"seconds" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	message, err := services.SetDisappearingTimer(c.Param("id"), userID, *req.Seconds)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidTimer):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrNotParticipant),
+			errors.Is(err, services.ErrPostingRestricted):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao alterar temporizador"})
+		}
+		return
+	}
+
+	// A alteração aparece na conversa como mensagem de sistema
+	notifyMessageParticipants(message, websocket.GetHub().NotifySystemMessage)
+
+	c.JSON(http.StatusOK, models.MessageDTO{
+		ID:        message.ID,
+		Seq:       message.Seq,
+		SenderID:  message.SenderID,
+		Type:      message.Type,
+		System:    message.System,
+		CreatedAt: message.CreatedAt,
+		Status:    models.StatusSent,
+	})
+}
+
+// notifyMessageParticipants envia o evento da mensagem aos participantes atuais da conversa
+func notifyMessageParticipants(message *models.Message, notify func(*models.Message, []string)) {
+	participantIDs, err := services.ParticipantIDs(message.ConversationID)
+	if err != nil {
+		log.Printf("Erro ao buscar participantes para notificação: %v", err)
+		return
+	}
+	notify(message, participantIDs)
 }
 
 // UpdateMessageStatus atualiza o status de uma mensagem para o usuário autenticado
@@ -254,7 +481,7 @@ func UpdateMessageStatus(c *gin.Context) {
 	}
 
 	var req struct {
-		Status string `json:"status" binding:"required,oneof=RECEIVED READ"`
+		Status string `json:"status" binding:"required,oneof=RECEIVED DELIVERED READ"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -262,57 +489,81 @@ func UpdateMessageStatus(c *gin.Context) {
 		return
 	}
 
-	result := config.DB.Model(&models.MessageRecipient{}).
-		Where("message_id = ? AND recipient_id = ?", messageID, userID).
-		Updates(map[string]interface{}{
-			"status":             req.Status,
-			"status_updated_at":  time.Now(),
-		})
-
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar status"})
-		return
+	// RECEIVED é aceito por compatibilidade com clientes antigos
+	status := req.Status
+	if status == "RECEIVED" {
+		status = models.StatusDelivered
 	}
 
-	if result.RowsAffected == 0 {
+	receipt, err := services.UpdateRecipientStatus(messageID, userID, status)
+	if errors.Is(err, services.ErrMessageNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Mensagem não encontrada"})
 		return
 	}
-
-	// Buscar a mensagem para obter o ID da conversa e o remetente
-	var message models.Message
-	if err := config.DB.First(&message, "id = ?", messageID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar mensagem"})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar status"})
 		return
 	}
 
-	// Buscar participantes da conversa para notificação
-	var participants []models.ConversationParticipant
-	if err := config.DB.Where("conversation_id = ?", message.ConversationID).Find(&participants).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar participantes"})
-		return
+	// Avisar o remetente com o recibo e os outros dispositivos do leitor para atualizar a contagem
+	if receipt != nil {
+		hub := websocket.GetHub()
+		hub.SendReceipts([]services.Receipt{*receipt})
+		hub.Notify("conversation_update", []string{userID}, gin.H{})
 	}
 
-	// Preparar lista de IDs de participantes para notificação
-	participantIDs := make([]string, 0, len(participants))
-	for _, p := range participants {
-		participantIDs = append(participantIDs, p.UserID)
-	}
+	c.JSON(http.StatusOK, gin.H{"message": "Status atualizado com sucesso"})
+}
 
-	// Notificar todos os participantes sobre a atualização da conversa
-	if len(participantIDs) > 0 {
-		go func() {
-			// Enviar notificação de atualização de conversa
-			updateNotification := websocket.BroadcastMessage{
-				Type:       "conversation_update",
-				Recipients: participantIDs,
-				Payload:    json.RawMessage(`{}`),
-				MessageID:  utils.GenerateUUID(),
-			}
+// selectRecipient escolhe o conteúdo cifrado para o dispositivo informado,
+// recorrendo ao conteúdo cifrado para a chave do usuário quando não houver um específico
+func selectRecipient(recipients []models.MessageRecipient, deviceID string) (models.MessageRecipient, bool) {
+	var fallback *models.MessageRecipient
+	for i, r := range recipients {
+		if deviceID != "" && r.DeviceID == deviceID {
+			return r, true
+		}
+		if r.DeviceID == "" && fallback == nil {
+			fallback = &recipients[i]
+		}
+	}
 
-			websocket.GetHub().Broadcast <- updateNotification
-		}()
+	if fallback == nil {
+		return models.MessageRecipient{}, false
 	}
+	return *fallback, true
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Status atualizado com sucesso"})
-}
\ No newline at end of file
+// respondMessageError traduz erros do serviço de mensagens em respostas HTTP
+func respondMessageError(c *gin.Context, err error) {
+	var validationErr *elgamal.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		respondValidationError(c, validationErr, "")
+	case errors.Is(err, services.ErrNotParticipant),
+		errors.Is(err, services.ErrPostingRestricted),
+		errors.Is(err, services.ErrNotMessageSender):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrMessageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrMessageDeleted):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrStaleEpoch),
+		errors.Is(err, services.ErrSenderKeyNotDistributed),
+		errors.Is(err, services.ErrClientIDConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrEmptyMessage),
+		errors.Is(err, services.ErrDeviceNotFound),
+		errors.Is(err, services.ErrDeviceRevoked),
+		errors.Is(err, services.ErrRecipientNotFound),
+		errors.Is(err, services.ErrRecipientNotParticipant),
+		errors.Is(err, services.ErrMixedVersions),
+		errors.Is(err, services.ErrSenderKeyModeDisabled),
+		errors.Is(err, services.ErrEpochRequired),
+		errors.Is(err, services.ErrRecipientsMismatch),
+		errors.Is(err, services.ErrInvalidClientID):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar mensagem"})
+	}
+}
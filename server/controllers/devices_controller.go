@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"server/config"
+	"server/models"
+	"server/utils"
+	"server/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AddDeviceRequest representa a payload para registrar um novo dispositivo
+type AddDeviceRequest struct {
+	Name      string               `json:"name" binding:"required"`
+	PublicKey models.PublicKeyData `json:"publicKey" binding:"required"`
+}
+
+// ListDevices lista os dispositivos do usuário autenticado, incluindo os revogados
+func ListDevices(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var devices []models.Device
+	if err := config.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&devices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar dispositivos"})
+		return
+	}
+
+	if devices == nil {
+		devices = []models.Device{}
+	}
+
+	c.JSON(http.StatusOK, devices)
+}
+
+// AddDevice registra um dispositivo com sua própria chave pública
+func AddDevice(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req AddDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !validatePublicKey(c, "publicKey", req.PublicKey) {
+		return
+	}
+
+	device := models.Device{
+		ID:        utils.GenerateUUID(),
+		UserID:    userID,
+		Name:      req.Name,
+		PublicKey: req.PublicKey,
+		CreatedAt: time.Now(),
+	}
+
+	if err := config.DB.Create(&device).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao registrar dispositivo"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, device)
+}
+
+// RevokeDevice revoga um dispositivo do usuário e encerra suas conexões ativas
+func RevokeDevice(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	deviceID := c.Param("id")
+
+	var device models.Device
+	if err := config.DB.Where("id = ? AND user_id = ?", deviceID, userID).First(&device).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dispositivo não encontrado"})
+		return
+	}
+
+	if device.IsRevoked() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Dispositivo já revogado"})
+		return
+	}
+
+	now := time.Now()
+	if err := config.DB.Model(&device).Update("revoked_at", now).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao revogar dispositivo"})
+		return
+	}
+
+	// Derrubar as conexões abertas pelo dispositivo revogado
+	websocket.GetHub().DisconnectDevice(userID, deviceID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Dispositivo revogado com sucesso"})
+}
+
+// ListUserDevices retorna os dispositivos ativos de um usuário para cifrar mensagens
+func ListUserDevices(c *gin.Context) {
+	targetUserID := c.Param("id")
+
+	var devices []models.Device
+	if err := config.DB.Where("user_id = ? AND revoked_at IS NULL", targetUserID).
+		Order("created_at ASC").
+		Find(&devices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar dispositivos"})
+		return
+	}
+
+	response := make([]models.DeviceDTO, 0, len(devices))
+	for _, d := range devices {
+		response = append(response, models.DeviceDTO{
+			ID:        d.ID,
+			Name:      d.Name,
+			PublicKey: d.PublicKey,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
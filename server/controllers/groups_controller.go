@@ -1,13 +1,16 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"server/config"
 	"server/models"
+	"server/services"
 	"server/utils"
+	"server/websocket"
 )
 
 type CreateGroupRequest struct {
@@ -77,10 +80,16 @@ func CreateGroup(c *gin.Context) {
 	// Adicionar todos os participantes, incluindo o criador do grupo
 	allParticipants := append(realParticipantIDs, userID)
 	for _, pid := range allParticipants {
+		role := models.RoleMember
+		if pid == userID {
+			role = models.RoleOwner
+		}
+
 		participant := models.ConversationParticipant{
 			ID:             utils.GenerateUUID(),
 			ConversationID: conversation.ID,
 			UserID:         pid,
+			Role:           role,
 			JoinedAt:       time.Now(),
 		}
 
@@ -91,6 +100,13 @@ func CreateGroup(c *gin.Context) {
 		}
 	}
 
+	// Registrar a composição inicial como a primeira época do grupo
+	if err := services.BumpGroupEpoch(tx, &group, allParticipants, services.EpochReasonCreated, userID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao registrar época do grupo"})
+		return
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao finalizar criação do grupo"})
@@ -98,4 +114,256 @@ func CreateGroup(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusCreated, group)
-}
\ No newline at end of file
+}
+// GroupMembersRequest representa a payload para adicionar membros ao grupo
+type GroupMembersRequest struct {
+	ParticipantIDs []string `json:"participant_ids" binding:"required,min=1"`
+}
+
+// RemoveGroupMembersRequest representa a payload para remover membros do grupo
+type RemoveGroupMembersRequest struct {
+	UserIDs []string `json:"user_ids" binding:"required,min=1"`
+}
+
+// UpdateGroupRequest representa a payload para alterar o nome e as configurações do grupo
+type UpdateGroupRequest struct {
+	Name                    *string `json:"name" binding:"omitempty,min=1"`
+	OnlyAdminsCanPost       *bool   `json:"onlyAdminsCanPost"`
+	OnlyAdminsCanAddMembers *bool   `json:"onlyAdminsCanAddMembers"`
+	SenderKeyMode           *bool   `json:"senderKeyMode"`
+}
+
+// TransferGroupRequest representa a payload para transferir a posse do grupo
+type TransferGroupRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+}
+
+// AddGroupMembers adiciona contatos do administrador ao grupo
+func AddGroupMembers(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req GroupMembersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Assim como na criação, os participantes são informados pelos IDs dos contatos
+	memberIDs, err := services.ResolveContactUserIDs(userID, req.ParticipantIDs)
+	if err != nil {
+		respondGroupError(c, err)
+		return
+	}
+
+	change, err := services.AddGroupMembers(c.Param("id"), userID, memberIDs)
+	if err != nil {
+		respondGroupError(c, err)
+		return
+	}
+
+	notifyGroupChange("members_added", userID, change)
+	requestSenderKeys(change)
+	c.JSON(http.StatusOK, groupResponse(change))
+}
+
+// RemoveGroupMembers remove membros do grupo
+func RemoveGroupMembers(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req RemoveGroupMembersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	change, err := services.RemoveGroupMembers(c.Param("id"), userID, req.UserIDs)
+	if err != nil {
+		respondGroupError(c, err)
+		return
+	}
+
+	notifyGroupChange("members_removed", userID, change)
+	requestSenderKeys(change)
+	c.JSON(http.StatusOK, groupResponse(change))
+}
+
+// LeaveGroup remove o usuário autenticado do grupo
+func LeaveGroup(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	change, err := services.LeaveGroup(c.Param("id"), userID)
+	if err != nil {
+		respondGroupError(c, err)
+		return
+	}
+
+	notifyGroupChange("member_left", userID, change)
+	requestSenderKeys(change)
+	c.JSON(http.StatusOK, gin.H{"message": "Você saiu do grupo"})
+}
+
+// UpdateGroup altera o nome e as configurações do grupo
+func UpdateGroup(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req UpdateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name == nil && req.OnlyAdminsCanPost == nil && req.OnlyAdminsCanAddMembers == nil && req.SenderKeyMode == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nenhuma alteração informada"})
+		return
+	}
+
+	change, err := services.UpdateGroupSettings(c.Param("id"), userID, services.GroupSettings{
+		Name:                    req.Name,
+		OnlyAdminsCanPost:       req.OnlyAdminsCanPost,
+		OnlyAdminsCanAddMembers: req.OnlyAdminsCanAddMembers,
+		SenderKeyMode:           req.SenderKeyMode,
+	})
+	if err != nil {
+		respondGroupError(c, err)
+		return
+	}
+
+	notifyGroupChange("settings_updated", userID, change)
+	if req.SenderKeyMode != nil && *req.SenderKeyMode {
+		requestSenderKeys(change)
+	}
+	c.JSON(http.StatusOK, groupResponse(change))
+}
+
+// PromoteGroupMember torna um membro administrador do grupo
+func PromoteGroupMember(c *gin.Context) {
+	changeMemberRole(c, models.RoleAdmin, "member_promoted")
+}
+
+// DemoteGroupMember rebaixa um administrador a membro comum
+func DemoteGroupMember(c *gin.Context) {
+	changeMemberRole(c, models.RoleMember, "member_demoted")
+}
+
+// changeMemberRole aplica a mudança de papel do membro indicado em :userId
+func changeMemberRole(c *gin.Context, role, event string) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	change, err := services.SetMemberRole(c.Param("id"), userID, c.Param("userId"), role)
+	if err != nil {
+		respondGroupError(c, err)
+		return
+	}
+
+	notifyGroupChange(event, userID, change)
+	c.JSON(http.StatusOK, groupResponse(change))
+}
+
+// TransferGroupOwnership transfere a posse do grupo para outro membro
+func TransferGroupOwnership(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req TransferGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	change, err := services.TransferGroupOwnership(c.Param("id"), userID, req.UserID)
+	if err != nil {
+		respondGroupError(c, err)
+		return
+	}
+
+	notifyGroupChange("ownership_transferred", userID, change)
+	c.JSON(http.StatusOK, groupResponse(change))
+}
+
+// ListGroupEpochs retorna o histórico de épocas do grupo com os membros de cada uma
+func ListGroupEpochs(c *gin.Context) {
+	epochs, err := services.ListGroupEpochs(c.Param("id"))
+	if err != nil {
+		respondGroupError(c, err)
+		return
+	}
+
+	if epochs == nil {
+		epochs = []models.GroupEpoch{}
+	}
+
+	c.JSON(http.StatusOK, epochs)
+}
+
+// groupResponse monta a resposta com o grupo e seus membros após a alteração
+func groupResponse(change *services.GroupChange) gin.H {
+	return gin.H{
+		"conversationId":          change.Group.ConversationID,
+		"name":                    change.Group.Name,
+		"adminId":                 change.Group.AdminID,
+		"epoch":                   change.Group.Epoch,
+		"onlyAdminsCanPost":       change.Group.OnlyAdminsCanPost,
+		"onlyAdminsCanAddMembers": change.Group.OnlyAdminsCanAddMembers,
+		"senderKeyMode":           change.Group.SenderKeyMode,
+		"memberIds":               change.MemberIDs,
+	}
+}
+
+// notifyGroupChange avisa os membros atuais e removidos sobre a alteração do grupo
+func notifyGroupChange(event, actorID string, change *services.GroupChange) {
+	websocket.GetHub().Notify("group_update", change.NotifyIDs, gin.H{
+		"conversationId": change.Group.ConversationID,
+		"event":          event,
+		"actorId":        actorID,
+		"userIds":        change.UserIDs,
+		"name":           change.Group.Name,
+		"adminId":        change.Group.AdminID,
+		"epoch":          change.Group.Epoch,
+		"memberIds":      change.MemberIDs,
+	})
+}
+
+// respondGroupError traduz erros do serviço de grupos em respostas HTTP
+func respondGroupError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrGroupNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotParticipant),
+		errors.Is(err, services.ErrNotGroupAdmin),
+		errors.Is(err, services.ErrNotGroupOwner),
+		errors.Is(err, services.ErrCannotRemoveAdmin):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAlreadyMember):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrContactsNotFound),
+		errors.Is(err, services.ErrNotMember),
+		errors.Is(err, services.ErrCannotRemoveOwner),
+		errors.Is(err, services.ErrInvalidRoleChange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar grupo"})
+	}
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"net/http"
+
+	"server/services"
+	"server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrivacySettingsRequest representa a payload para alterar as configurações de privacidade
+type PrivacySettingsRequest struct {
+	HideLastSeen *bool `json:"hideLastSeen" binding:"required"`
+}
+
+// GetPrivacySettings retorna as configurações de privacidade do usuário autenticado
+func GetPrivacySettings(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	hidden, err := services.HidesLastSeen(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"hideLastSeen": hidden})
+}
+
+// UpdatePrivacySettings altera a visibilidade do último acesso do usuário
+func UpdatePrivacySettings(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req PrivacySettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.SetHideLastSeen(userID, *req.HideLastSeen); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar privacidade"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"hideLastSeen": *req.HideLastSeen})
+}
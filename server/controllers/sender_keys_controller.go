@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"server/crypto/elgamal"
+	"server/models"
+	"server/services"
+	"server/utils"
+	"server/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DistributeSenderKeyRequest representa a payload com a chave de remetente cifrada para cada membro
+type DistributeSenderKeyRequest struct {
+	KeyID       string                           `json:"keyId" binding:"required"`
+	Epoch       *int64                           `json:"epoch" binding:"required"`
+	WrappedKeys map[string]models.ElGamalContent `json:"wrappedKeys" binding:"required"`
+}
+
+// DistributeSenderKey registra a chave de remetente do usuário para a época atual do grupo
+func DistributeSenderKey(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req DistributeSenderKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	conversationID := c.Param("id")
+	recipientIDs, err := services.DistributeSenderKey(services.SenderKeyDistributionInput{
+		ConversationID: conversationID,
+		SenderID:       userID,
+		Epoch:          *req.Epoch,
+		KeyID:          req.KeyID,
+		WrappedKeys:    req.WrappedKeys,
+	})
+	if err != nil {
+		respondSenderKeyError(c, err)
+		return
+	}
+
+	// Os destinatários buscam a chave cifrada para eles em GET /sender-keys
+	websocket.GetHub().Notify("sender_key", recipientIDs, gin.H{
+		"conversationId": conversationID,
+		"senderId":       userID,
+		"epoch":          *req.Epoch,
+		"keyId":          req.KeyID,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{"epoch": *req.Epoch, "keyId": req.KeyID, "recipientIds": recipientIDs})
+}
+
+// ListSenderKeys retorna as chaves de remetente cifradas para o usuário autenticado
+func ListSenderKeys(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var epoch *int64
+	if raw := c.Query("epoch"); raw != "" {
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Época inválida"})
+			return
+		}
+		epoch = &value
+	}
+
+	distributions, err := services.ListSenderKeys(c.Param("id"), userID, epoch)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar chaves de remetente"})
+		return
+	}
+
+	if distributions == nil {
+		distributions = []models.SenderKeyDistribution{}
+	}
+
+	c.JSON(http.StatusOK, distributions)
+}
+
+// requestSenderKeys pede aos membros que distribuam novas chaves de remetente após
+// uma mudança de época, para que membros removidos não decifrem mensagens futuras
+func requestSenderKeys(change *services.GroupChange) {
+	if !change.Group.SenderKeyMode {
+		return
+	}
+
+	websocket.GetHub().Notify("sender_key_rotation", change.MemberIDs, gin.H{
+		"conversationId": change.Group.ConversationID,
+		"epoch":          change.Group.Epoch,
+		"memberIds":      change.MemberIDs,
+	})
+}
+
+// respondSenderKeyError traduz erros da distribuição de chaves em respostas HTTP
+func respondSenderKeyError(c *gin.Context, err error) {
+	var validationErr *elgamal.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		respondValidationError(c, validationErr, "")
+	case errors.Is(err, services.ErrGroupNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotParticipant):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrStaleEpoch):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSenderKeyModeDisabled),
+		errors.Is(err, services.ErrSenderKeyIncomplete),
+		errors.Is(err, services.ErrRecipientNotParticipant),
+		errors.Is(err, services.ErrRecipientNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao distribuir chave de remetente"})
+	}
+}
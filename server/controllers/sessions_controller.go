@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"server/services"
+	"server/utils"
+	"server/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListSessions lista as sessões ativas do usuário, indicando a sessão da requisição
+func ListSessions(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	currentID := c.GetString("session_id")
+
+	sessions, err := services.ListSessions(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar sessões"})
+		return
+	}
+
+	response := make([]gin.H, 0, len(sessions))
+	for _, s := range sessions {
+		response = append(response, gin.H{
+			"id":         s.ID,
+			"userAgent":  s.UserAgent,
+			"ip":         s.IP,
+			"createdAt":  s.CreatedAt,
+			"lastUsedAt": s.LastUsedAt,
+			"expiresAt":  s.ExpiresAt,
+			"current":    s.ID == currentID,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeSession encerra uma sessão do usuário e desconecta seus WebSockets
+func RevokeSession(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	sessionID := c.Param("id")
+	if err := services.RevokeSession(userID, sessionID); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao encerrar sessão"})
+		return
+	}
+
+	websocket.GetHub().DisconnectSession(userID, sessionID)
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"server/crypto/elgamal"
+	"server/crypto/keywrap"
+	"server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validatePublicKey valida a chave pública e responde 400 com os detalhes quando inválida
+func validatePublicKey(c *gin.Context, field string, key models.PublicKeyData) bool {
+	if err := elgamal.ValidatePublicKey(key.P, key.G, key.Y); err != nil {
+		respondValidationError(c, err, field)
+		return false
+	}
+	return true
+}
+
+// validateKeyWrap rejeita parâmetros de cifragem da chave privada fracos ou desconhecidos
+func validateKeyWrap(c *gin.Context, field string, params keywrap.Params) bool {
+	err := keywrap.Validate(params)
+	if err == nil {
+		return true
+	}
+
+	validationErr := err.(*keywrap.ValidationError).WithPrefix(field)
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": validationErr.Error(),
+		"code":  validationErr.Code,
+		"field": validationErr.Field,
+	})
+	return false
+}
+
+// respondValidationError responde com o erro de validação estruturado
+func respondValidationError(c *gin.Context, err error, field string) {
+	var validationErr *elgamal.ValidationError
+	if !errors.As(err, &validationErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if field != "" {
+		validationErr = validationErr.WithPrefix(field)
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": validationErr.Error(),
+		"code":  validationErr.Code,
+		"field": validationErr.Field,
+	})
+}
@@ -1,14 +1,26 @@
 package controllers
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"strings"
+	"time"
+
+	"server/config"
+	"server/models"
+	"server/services"
+	"server/utils"
 	"server/websocket"
 
 	"github.com/gin-gonic/gin"
 	gorilla "github.com/gorilla/websocket"
 )
 
+// wsAuthSubprotocol é o subprotocolo usado pelos navegadores para enviar o token,
+// já que a API WebSocket não permite definir o cabeçalho Authorization
+const wsAuthSubprotocol = "bearer"
+
 var upgrader = gorilla.Upgrader{
     ReadBufferSize:  1024,
     WriteBufferSize: 1024,
@@ -17,26 +29,86 @@ var upgrader = gorilla.Upgrader{
     },
 }
 
+// CreateWSTicket emite um ticket de uso único para abrir o WebSocket
+func CreateWSTicket(c *gin.Context) {
+    userID, err := utils.GetUserIDFromContext(c)
+    if err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+        return
+    }
+
+    tokenExpiresAt, ok := c.Get("token_expires_at")
+    if !ok {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Token sem data de expiração"})
+        return
+    }
+
+    ticket, expiresAt := services.IssueWSTicket(userID, c.GetString("session_id"), tokenExpiresAt.(time.Time))
+
+    c.JSON(http.StatusCreated, gin.H{
+        "ticket":    ticket,
+        "expiresAt": expiresAt,
+    })
+}
+
 func ServeWS(c *gin.Context, hub *websocket.Hub) {
-    userID := c.Query("userId")
-    if userID == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "ID do usuário é obrigatório"})
+    claims, subprotocol, err := authenticateWS(c)
+    if err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+        return
+    }
+    if err := services.RequireActiveSession(claims.UserID, claims.SessionID); err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+        return
+    }
+    userID, expiresAt := claims.UserID, claims.ExpiresAt
+
+    // Cada conexão recebe um ID próprio; o dispositivo é informado pelo cliente
+    connectionID := utils.GenerateUUID()
+    deviceID := c.Query("deviceId")
+    if deviceID == "" {
+        deviceID = connectionID
+    }
+
+    // Um dispositivo registrado só pode conectar se pertencer ao usuário e estiver ativo
+    var device models.Device
+    if err := config.DB.First(&device, "id = ?", deviceID).Error; err == nil {
+        if device.UserID != userID || device.IsRevoked() {
+            c.JSON(http.StatusForbidden, gin.H{"error": "Dispositivo não autorizado"})
+            return
+        }
+    }
+
+    // Última sequência vista em cada conversa, para reenviar o que chegou desde então
+    cursor, err := services.DecodeSyncCursor(c.Query("cursor"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
 
     log.Printf("Iniciando conexão WebSocket para usuário: %s", userID)
 
-    conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+    var responseHeader http.Header
+    if subprotocol != "" {
+        responseHeader = http.Header{"Sec-WebSocket-Protocol": []string{subprotocol}}
+    }
+
+    conn, err := upgrader.Upgrade(c.Writer, c.Request, responseHeader)
     if err != nil {
         log.Printf("Erro ao atualizar para WebSocket: %v", err)
         return
     }
 
     client := &websocket.Client{
-        Hub:    hub,
-        UserID: userID,
-        Conn:   conn,
-        Send:   make(chan []byte, 256),
+        Hub:          hub,
+        ID:           connectionID,
+        UserID:       userID,
+        DeviceID:     deviceID,
+        SessionID:    claims.SessionID,
+        Conn:         conn,
+        Send:         make(chan []byte, 256),
+        ExpiresAt:    expiresAt,
+        ReplayCursor: cursor,
     }
 
     log.Printf("Registrando cliente WebSocket para usuário: %s", userID)
@@ -47,4 +119,27 @@ func ServeWS(c *gin.Context, hub *websocket.Hub) {
     go client.ReadPump()
 
     log.Printf("Conexão WebSocket estabelecida para usuário: %s", userID)
-}
\ No newline at end of file
+}
+
+// authenticateWS extrai as credenciais do pedido de upgrade, na ordem:
+// cabeçalho Authorization, subprotocolo "bearer, <token>" ou ticket na query.
+// Retorna também o subprotocolo que deve ser ecoado na resposta.
+func authenticateWS(c *gin.Context) (*services.TokenClaims, string, error) {
+    if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+        claims, err := services.ParseAccessToken(strings.TrimPrefix(authHeader, "Bearer "))
+        return claims, "", err
+    }
+
+    protocols := gorilla.Subprotocols(c.Request)
+    if len(protocols) == 2 && protocols[0] == wsAuthSubprotocol {
+        claims, err := services.ParseAccessToken(protocols[1])
+        return claims, wsAuthSubprotocol, err
+    }
+
+    if ticket := c.Query("ticket"); ticket != "" {
+        claims, err := services.RedeemWSTicket(ticket)
+        return claims, "", err
+    }
+
+    return nil, "", errors.New("token não fornecido")
+}
@@ -0,0 +1,153 @@
+package elgamal
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"math/big"
+)
+
+var (
+	ErrEmptyMessage   = errors.New("mensagem vazia")
+	ErrMessageTooLong = errors.New("mensagem muito longa para o módulo da chave")
+	ErrInvalidNonce   = errors.New("k deve estar no intervalo [2, p-2]")
+	ErrNoGenerator    = errors.New("raiz primitiva não encontrada")
+
+	ErrModulusMismatch = errors.New("texto cifrado inválido: módulo ausente ou diferente do da chave")
+	ErrCiphertextRange = errors.New("texto cifrado inválido: exige 0 < a < p e 0 <= b < p")
+)
+
+// generatorCandidates são os mesmos candidatos testados pelo cliente TypeScript
+var generatorCandidates = []int64{2, 3, 5, 7, 11}
+
+// PrivateKey é o par de chaves ElGamal
+type PrivateKey struct {
+	PublicKey
+	X *big.Int
+}
+
+// GenerateKey gera um par de chaves com módulo p = 2q + 1 de bits bits,
+// seguindo o mesmo procedimento de ElGamal.generateKeys no cliente
+func GenerateKey(random io.Reader, bits int) (*PrivateKey, error) {
+	var p, g *big.Int
+	for {
+		q, err := rand.Prime(random, bits-1)
+		if err != nil {
+			return nil, err
+		}
+		p = new(big.Int).Add(new(big.Int).Lsh(q, 1), one)
+		if !p.ProbablyPrime(primalityRounds) {
+			continue
+		}
+		// Diferente do cliente, tenta outro primo se nenhum candidato servir
+		if g, err = findPrimitiveRoot(p, q); err == nil {
+			break
+		}
+	}
+
+	x, err := randRange(random, two, new(big.Int).Sub(p, two))
+	if err != nil {
+		return nil, err
+	}
+
+	return &PrivateKey{
+		PublicKey: PublicKey{P: p, G: g, Y: new(big.Int).Exp(g, x, p)},
+		X:         x,
+	}, nil
+}
+
+// Encrypt cifra a mensagem com um k aleatório em [2, p-2]
+func Encrypt(random io.Reader, pub *PublicKey, message string) (*Ciphertext, error) {
+	k, err := randRange(random, two, new(big.Int).Sub(pub.P, two))
+	if err != nil {
+		return nil, err
+	}
+	return EncryptWithNonce(pub, message, k)
+}
+
+// EncryptWithNonce cifra a mensagem com o k informado.
+// Existe para reproduzir os vetores de teste; em produção use Encrypt.
+func EncryptWithNonce(pub *PublicKey, message string, k *big.Int) (*Ciphertext, error) {
+	if !inRange(k, two, new(big.Int).Sub(pub.P, two)) {
+		return nil, ErrInvalidNonce
+	}
+
+	m, err := EncodeMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	if m.Cmp(pub.P) >= 0 {
+		return nil, ErrMessageTooLong
+	}
+
+	a := new(big.Int).Exp(pub.G, k, pub.P)
+	s := new(big.Int).Exp(pub.Y, k, pub.P)
+	b := new(big.Int).Mod(new(big.Int).Mul(m, s), pub.P)
+
+	return &Ciphertext{A: a, B: b, P: new(big.Int).Set(pub.P)}, nil
+}
+
+// Decrypt recupera a mensagem a partir do texto cifrado
+func Decrypt(priv *PrivateKey, c *Ciphertext) (string, error) {
+	p := priv.P
+	if err := checkCiphertext(p, c); err != nil {
+		return "", err
+	}
+
+	s := new(big.Int).Exp(c.A, priv.X, p)
+	sInv := new(big.Int).ModInverse(s, p)
+	if sInv == nil {
+		return "", errors.New("inverso modular não existe")
+	}
+
+	m := new(big.Int).Mod(new(big.Int).Mul(c.B, sInv), p)
+	return DecodeMessage(m), nil
+}
+
+// checkCiphertext exige que o texto cifrado use o módulo p da chave privada, e não o
+// informado por quem cifrou, e que 0 < a < p e 0 <= b < p
+func checkCiphertext(p *big.Int, c *Ciphertext) error {
+	if c == nil || c.P == nil || c.A == nil || c.B == nil || c.P.Cmp(p) != 0 {
+		return ErrModulusMismatch
+	}
+	if c.A.Sign() <= 0 || c.A.Cmp(p) >= 0 || c.B.Sign() < 0 || c.B.Cmp(p) >= 0 {
+		return ErrCiphertextRange
+	}
+	return nil
+}
+
+// EncodeMessage interpreta os bytes UTF-8 da mensagem como um inteiro big-endian,
+// como stringToBigInt no cliente
+func EncodeMessage(message string) (*big.Int, error) {
+	if message == "" {
+		return nil, ErrEmptyMessage
+	}
+	return new(big.Int).SetBytes([]byte(message)), nil
+}
+
+// DecodeMessage faz o caminho inverso de EncodeMessage, como bigIntToString no cliente
+func DecodeMessage(m *big.Int) string {
+	return string(m.Bytes())
+}
+
+// findPrimitiveRoot procura um gerador de Z_p* sabendo que p = 2q + 1
+func findPrimitiveRoot(p, q *big.Int) (*big.Int, error) {
+	for _, candidate := range generatorCandidates {
+		g := big.NewInt(candidate)
+		if new(big.Int).Exp(g, two, p).Cmp(one) != 0 &&
+			new(big.Int).Exp(g, q, p).Cmp(one) != 0 {
+			return g, nil
+		}
+	}
+	return nil, ErrNoGenerator
+}
+
+// randRange retorna um inteiro uniforme em [min, max]
+func randRange(random io.Reader, min, max *big.Int) (*big.Int, error) {
+	span := new(big.Int).Add(new(big.Int).Sub(max, min), one)
+	n, err := rand.Int(random, span)
+	if err != nil {
+		return nil, err
+	}
+	return n.Add(n, min), nil
+}
@@ -0,0 +1,263 @@
+package elgamal
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"math/big"
+	"os"
+	"testing"
+)
+
+// vector espelha uma entrada de testdata/vectors.json, também lida pelo cliente
+type vector struct {
+	Name    string `json:"name"`
+	P       string `json:"p"`
+	G       string `json:"g"`
+	Y       string `json:"y"`
+	X       string `json:"x"`
+	K       string `json:"k"`
+	Message string `json:"message"`
+	M       string `json:"m"`
+	A       string `json:"a"`
+	B       string `json:"b"`
+}
+
+func loadVectors(t *testing.T) []vector {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/vectors.json")
+	if err != nil {
+		t.Fatalf("erro ao ler vetores: %v", err)
+	}
+
+	var file struct {
+		Vectors []vector `json:"vectors"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("erro ao decodificar vetores: %v", err)
+	}
+	if len(file.Vectors) == 0 {
+		t.Fatal("nenhum vetor encontrado")
+	}
+	return file.Vectors
+}
+
+func mustInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		t.Fatalf("inteiro inválido: %q", s)
+	}
+	return n
+}
+
+func TestVectors(t *testing.T) {
+	for _, v := range loadVectors(t) {
+		t.Run(v.Name, func(t *testing.T) {
+			pub, err := ParsePublicKey(v.P, v.G, v.Y)
+			if err != nil {
+				t.Fatalf("chave pública rejeitada: %v", err)
+			}
+
+			m, err := EncodeMessage(v.Message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.String() != v.M {
+				t.Errorf("codificação = %s, esperado %s", m, v.M)
+			}
+
+			c, err := EncryptWithNonce(pub, v.Message, mustInt(t, v.K))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.A.String() != v.A || c.B.String() != v.B {
+				t.Errorf("cifra = (%s, %s), esperado (%s, %s)", c.A, c.B, v.A, v.B)
+			}
+
+			if err := ValidateCiphertext(v.A, v.B, v.P, v.P); err != nil {
+				t.Errorf("texto cifrado rejeitado: %v", err)
+			}
+
+			priv := &PrivateKey{PublicKey: *pub, X: mustInt(t, v.X)}
+			got, err := Decrypt(priv, &Ciphertext{A: mustInt(t, v.A), B: mustInt(t, v.B), P: pub.P})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != v.Message {
+				t.Errorf("Decrypt = %q, esperado %q", got, v.Message)
+			}
+		})
+	}
+}
+
+func TestGenerateKeyRoundTrip(t *testing.T) {
+	priv, err := GenerateKey(rand.Reader, MinPrimeBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidatePublicKey(priv.P.String(), priv.G.String(), priv.Y.String()); err != nil {
+		t.Fatalf("chave gerada rejeitada: %v", err)
+	}
+
+	c, err := Encrypt(rand.Reader, &priv.PublicKey, "mensagem de teste")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Decrypt(priv, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "mensagem de teste" {
+		t.Errorf("Decrypt = %q", got)
+	}
+}
+
+func TestEncryptRejectsLongMessage(t *testing.T) {
+	v := loadVectors(t)[0]
+	pub, err := ParsePublicKey(v.P, v.G, v.Y)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	long := string(make([]byte, len(pub.P.Bytes())+1))
+	if _, err := Encrypt(rand.Reader, pub, "x"+long); err != ErrMessageTooLong {
+		t.Errorf("erro = %v, esperado ErrMessageTooLong", err)
+	}
+}
+
+func TestDecryptRejectsForeignModulus(t *testing.T) {
+	v := loadVectors(t)[0]
+	pub, err := ParsePublicKey(v.P, v.G, v.Y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv := &PrivateKey{PublicKey: *pub, X: mustInt(t, v.X)}
+	a, b := mustInt(t, v.A), mustInt(t, v.B)
+
+	tests := []struct {
+		name string
+		c    *Ciphertext
+		err  error
+	}{
+		{"p nulo", &Ciphertext{A: a, B: b}, ErrModulusMismatch},
+		{"p zero", &Ciphertext{A: a, B: b, P: big.NewInt(0)}, ErrModulusMismatch},
+		{"p diferente", &Ciphertext{A: a, B: b, P: new(big.Int).Add(pub.P, two)}, ErrModulusMismatch},
+		{"a nulo", &Ciphertext{B: b, P: pub.P}, ErrModulusMismatch},
+		{"a igual a p", &Ciphertext{A: pub.P, B: b, P: pub.P}, ErrCiphertextRange},
+		{"b negativo", &Ciphertext{A: a, B: big.NewInt(-1), P: pub.P}, ErrCiphertextRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decrypt(priv, tt.c); err != tt.err {
+				t.Errorf("erro = %v, esperado %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidationRejectsBadInputs(t *testing.T) {
+	v := loadVectors(t)[0]
+
+	tests := []struct {
+		name string
+		err  error
+		code string
+	}{
+		{"módulo pequeno", ValidatePublicKey("23", "5", "8"), CodePrimeTooSmall},
+		{"gerador inválido", ValidatePublicKey(v.P, "1", v.Y), CodeInvalidGenerator},
+		{"y fora do intervalo", ValidatePublicKey(v.P, v.G, "1"), CodeOutOfRange},
+		{"inteiro inválido", ValidatePublicKey("abc", v.G, v.Y), CodeInvalidInteger},
+		{"a fora do intervalo", ValidateCiphertext(v.P, v.B, v.P, v.P), CodeOutOfRange},
+		{"módulo divergente", ValidateCiphertext(v.A, v.B, v.P, "7"), CodeKeyMismatch},
+		{"versão desconhecida", ValidateEnvelope(9, "", ""), CodeUnsupportedVersion},
+		{"chave de remetente sem keyId", ValidateSenderKeyContent("", "", ""), CodeInvalidEnvelope},
+		{"corpo sem preenchimento", ValidateSenderKeyContent("k1", "AAAAAAAAAAAAAAAA", "AAAA"), CodeInvalidEnvelope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validationErr, ok := tt.err.(*ValidationError)
+			if !ok {
+				t.Fatalf("erro = %v, esperado *ValidationError", tt.err)
+			}
+			if validationErr.Code != tt.code {
+				t.Errorf("código = %s, esperado %s", validationErr.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	v := loadVectors(t)[0]
+	pub, err := ParsePublicKey(v.P, v.G, v.Y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv := &PrivateKey{PublicKey: *pub, X: mustInt(t, v.X)}
+
+	// Mensagem maior que o módulo, impossível no formato legado
+	plaintext := []byte("Olá! Esta mensagem é bem maior que os 32 bytes de um módulo de 256 bits 🔐")
+
+	env, err := Seal(rand.Reader, pub, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env.Body)-envelopeTagSize != 2*EnvelopeBlockSize {
+		t.Errorf("corpo com %d bytes, esperado preenchimento em blocos de %d", len(env.Body), EnvelopeBlockSize)
+	}
+
+	got, err := Open(priv, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(plaintext) {
+		t.Errorf("Open = %q", got)
+	}
+
+	env.Body[0] ^= 1
+	if _, err := Open(priv, env); err != ErrEnvelopeCorrupted {
+		t.Errorf("erro = %v, esperado ErrEnvelopeCorrupted", err)
+	}
+}
+
+func TestOpenRejectsForeignModulus(t *testing.T) {
+	v := loadVectors(t)[0]
+	pub, err := ParsePublicKey(v.P, v.G, v.Y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv := &PrivateKey{PublicKey: *pub, X: mustInt(t, v.X)}
+
+	env, err := Seal(rand.Reader, pub, []byte("segredo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := env.Key.A, env.Key.B
+
+	tests := []struct {
+		name string
+		env  *Envelope
+		err  error
+	}{
+		{"envelope nulo", nil, ErrEnvelopeCorrupted},
+		{"chave nula", &Envelope{Nonce: env.Nonce, Body: env.Body}, ErrModulusMismatch},
+		{"p nulo", &Envelope{Key: &Ciphertext{A: a, B: b}, Nonce: env.Nonce, Body: env.Body}, ErrModulusMismatch},
+		{"p diferente", &Envelope{Key: &Ciphertext{A: a, B: b, P: new(big.Int).Add(pub.P, two)}, Nonce: env.Nonce, Body: env.Body}, ErrModulusMismatch},
+		{"a zero", &Envelope{Key: &Ciphertext{A: big.NewInt(0), B: b, P: pub.P}, Nonce: env.Nonce, Body: env.Body}, ErrCiphertextRange},
+		{"a igual a p", &Envelope{Key: &Ciphertext{A: pub.P, B: b, P: pub.P}, Nonce: env.Nonce, Body: env.Body}, ErrCiphertextRange},
+		{"b negativo", &Envelope{Key: &Ciphertext{A: a, B: big.NewInt(-1), P: pub.P}, Nonce: env.Nonce, Body: env.Body}, ErrCiphertextRange},
+		{"b igual a p", &Envelope{Key: &Ciphertext{A: a, B: pub.P, P: pub.P}, Nonce: env.Nonce, Body: env.Body}, ErrCiphertextRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Open(priv, tt.env); err != tt.err {
+				t.Errorf("erro = %v, esperado %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package elgamal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Versões do formato de conteúdo cifrado
+const (
+	// VersionLegacy cifra a mensagem inteira diretamente com ElGamal (a, b, p)
+	VersionLegacy = 1
+	// VersionHybrid encapsula uma chave aleatória com ElGamal e cifra o corpo com AES-256-GCM
+	VersionHybrid = 2
+	// VersionSenderKey cifra o corpo uma única vez com a chave de remetente do grupo,
+	// distribuída previamente a cada membro em envelopes híbridos
+	VersionSenderKey = 3
+)
+
+const (
+	// EnvelopeBlockSize é o múltiplo para o qual o corpo é preenchido, ocultando o tamanho exato
+	EnvelopeBlockSize = 64
+	// EnvelopeNonceSize é o tamanho do nonce do AES-GCM
+	EnvelopeNonceSize = 12
+
+	envelopeTagSize = 16
+	envelopeKDFInfo = "chat-e2ee/envelope/v2"
+)
+
+// Códigos de erro específicos do envelope
+const (
+	CodeUnsupportedVersion = "unsupported_version"
+	CodeInvalidEnvelope    = "invalid_envelope"
+)
+
+var ErrEnvelopeCorrupted = errors.New("envelope corrompido ou chave incorreta")
+
+// Envelope é o conteúdo cifrado na versão híbrida.
+// Key carrega a semente da chave simétrica cifrada com ElGamal.
+type Envelope struct {
+	Key   *Ciphertext
+	Nonce []byte
+	Body  []byte
+}
+
+// Seal gera uma semente aleatória em [2, p-2], cifra a semente com ElGamal e usa
+// a chave derivada dela para cifrar o texto com AES-256-GCM
+func Seal(random io.Reader, pub *PublicKey, plaintext []byte) (*Envelope, error) {
+	seed, err := randRange(random, two, new(big.Int).Sub(pub.P, two))
+	if err != nil {
+		return nil, err
+	}
+	k, err := randRange(random, two, new(big.Int).Sub(pub.P, two))
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Ciphertext{
+		A: new(big.Int).Exp(pub.G, k, pub.P),
+		B: new(big.Int).Mod(new(big.Int).Mul(seed, new(big.Int).Exp(pub.Y, k, pub.P)), pub.P),
+		P: new(big.Int).Set(pub.P),
+	}
+
+	aead, err := envelopeAEAD(seed, pub.P)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, EnvelopeNonceSize)
+	if _, err := io.ReadFull(random, nonce); err != nil {
+		return nil, err
+	}
+
+	body := aead.Seal(nil, nonce, pad(plaintext), envelopeAAD(key))
+	return &Envelope{Key: key, Nonce: nonce, Body: body}, nil
+}
+
+// Open recupera a semente com a chave privada e decifra o corpo do envelope
+func Open(priv *PrivateKey, env *Envelope) ([]byte, error) {
+	if env == nil {
+		return nil, ErrEnvelopeCorrupted
+	}
+	// Como em Decrypt, a semente é decifrada no módulo da chave privada
+	p := priv.P
+	if err := checkCiphertext(p, env.Key); err != nil {
+		return nil, err
+	}
+
+	s := new(big.Int).Exp(env.Key.A, priv.X, p)
+	sInv := new(big.Int).ModInverse(s, p)
+	if sInv == nil {
+		return nil, ErrEnvelopeCorrupted
+	}
+	seed := new(big.Int).Mod(new(big.Int).Mul(env.Key.B, sInv), p)
+
+	aead, err := envelopeAEAD(seed, p)
+	if err != nil {
+		return nil, err
+	}
+
+	padded, err := aead.Open(nil, env.Nonce, env.Body, envelopeAAD(env.Key))
+	if err != nil {
+		return nil, ErrEnvelopeCorrupted
+	}
+
+	return unpad(padded)
+}
+
+// ValidateEnvelope confere a versão e, para envelopes híbridos, o formato do nonce e do corpo
+// recebidos em base64. Não é possível verificar a autenticidade sem a chave privada.
+func ValidateEnvelope(version int, nonce, body string) error {
+	switch version {
+	case 0, VersionLegacy:
+		if nonce != "" || body != "" {
+			return &ValidationError{Field: "v", Code: CodeInvalidEnvelope, Message: "conteúdo legado não aceita nonce nem ct"}
+		}
+		return nil
+	case VersionHybrid:
+	default:
+		return &ValidationError{Field: "v", Code: CodeUnsupportedVersion, Message: fmt.Sprintf("versão %d não suportada", version)}
+	}
+
+	return validateSealedBody(nonce, body)
+}
+
+// ValidateSenderKeyContent confere o identificador da chave e o formato do corpo
+// cifrado com a chave de remetente, que segue o mesmo preenchimento do envelope
+func ValidateSenderKeyContent(keyID, nonce, body string) error {
+	if keyID == "" {
+		return &ValidationError{Field: "keyId", Code: CodeInvalidEnvelope, Message: "keyId é obrigatório"}
+	}
+	return validateSealedBody(nonce, body)
+}
+
+// validateSealedBody verifica o nonce e o corpo AES-GCM preenchido em blocos
+func validateSealedBody(nonce, body string) error {
+	n, err := base64.StdEncoding.DecodeString(nonce)
+	if err != nil || len(n) != EnvelopeNonceSize {
+		return &ValidationError{Field: "nonce", Code: CodeInvalidEnvelope, Message: fmt.Sprintf("nonce deve ter %d bytes em base64", EnvelopeNonceSize)}
+	}
+
+	b, err := base64.StdEncoding.DecodeString(body)
+	if err != nil || len(b) < envelopeTagSize+EnvelopeBlockSize || (len(b)-envelopeTagSize)%EnvelopeBlockSize != 0 {
+		return &ValidationError{Field: "ct", Code: CodeInvalidEnvelope, Message: "ct deve ser base64 de um corpo preenchido em blocos"}
+	}
+
+	return nil
+}
+
+// envelopeAEAD deriva a chave AES-256 da semente com tamanho fixo igual ao de p
+func envelopeAEAD(seed, p *big.Int) (cipher.AEAD, error) {
+	h := sha256.New()
+	h.Write([]byte(envelopeKDFInfo))
+	h.Write(seed.FillBytes(make([]byte, len(p.Bytes()))))
+
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// envelopeAAD vincula o corpo cifrado à semente encapsulada
+func envelopeAAD(key *Ciphertext) []byte {
+	return []byte(fmt.Sprintf("%s|%s|%s|%s", envelopeKDFInfo, key.A, key.B, key.P))
+}
+
+// pad aplica o preenchimento ISO/IEC 7816-4 até um múltiplo de EnvelopeBlockSize
+func pad(data []byte) []byte {
+	size := (len(data)/EnvelopeBlockSize + 1) * EnvelopeBlockSize
+	padded := make([]byte, size)
+	copy(padded, data)
+	padded[len(data)] = 0x80
+	return padded
+}
+
+// unpad remove o preenchimento aplicado por pad
+func unpad(data []byte) ([]byte, error) {
+	for i := len(data) - 1; i >= 0; i-- {
+		switch data[i] {
+		case 0x00:
+			continue
+		case 0x80:
+			return data[:i], nil
+		}
+		break
+	}
+	return nil, ErrEnvelopeCorrupted
+}
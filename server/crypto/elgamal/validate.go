@@ -0,0 +1,164 @@
+// Package elgamal implementa as verificações do esquema ElGamal usado pelos clientes
+package elgamal
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// MinPrimeBits é o tamanho mínimo aceito para o módulo p.
+// Corresponde ao tamanho gerado pelo cliente em client/src/utils/elgamal.ts.
+const MinPrimeBits = 256
+
+// primalityRounds define as rodadas de Miller-Rabin usadas nas verificações
+const primalityRounds = 20
+
+// Códigos de erro retornados nas validações
+const (
+	CodeInvalidInteger   = "invalid_integer"
+	CodePrimeTooSmall    = "prime_too_small"
+	CodeNotSafePrime     = "not_safe_prime"
+	CodeInvalidGenerator = "invalid_generator"
+	CodeOutOfRange       = "out_of_range"
+	CodeKeyMismatch      = "key_mismatch"
+)
+
+var (
+	one = big.NewInt(1)
+	two = big.NewInt(2)
+)
+
+// ValidationError descreve por que uma chave ou um texto cifrado foi rejeitado
+type ValidationError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// WithPrefix retorna uma cópia do erro com o campo qualificado pelo prefixo
+func (e *ValidationError) WithPrefix(prefix string) *ValidationError {
+	return &ValidationError{
+		Field:   prefix + "." + e.Field,
+		Code:    e.Code,
+		Message: e.Message,
+	}
+}
+
+// PublicKey é a chave pública ElGamal com os valores já convertidos
+type PublicKey struct {
+	P *big.Int
+	G *big.Int
+	Y *big.Int
+}
+
+// Ciphertext é o par (a, b) cifrado sob o módulo p
+type Ciphertext struct {
+	A *big.Int
+	B *big.Int
+	P *big.Int
+}
+
+// ParsePublicKey converte e valida uma chave pública recebida como strings decimais.
+// O módulo deve ser um primo seguro p = 2q + 1 e g deve gerar todo o grupo Z_p*,
+// que é o que o cliente produz ao escolher uma raiz primitiva.
+func ParsePublicKey(p, g, y string) (*PublicKey, error) {
+	pInt, err := parseInt("p", p)
+	if err != nil {
+		return nil, err
+	}
+	gInt, err := parseInt("g", g)
+	if err != nil {
+		return nil, err
+	}
+	yInt, err := parseInt("y", y)
+	if err != nil {
+		return nil, err
+	}
+
+	if pInt.BitLen() < MinPrimeBits {
+		return nil, &ValidationError{
+			Field:   "p",
+			Code:    CodePrimeTooSmall,
+			Message: fmt.Sprintf("o módulo deve ter pelo menos %d bits", MinPrimeBits),
+		}
+	}
+
+	q := new(big.Int).Rsh(new(big.Int).Sub(pInt, one), 1)
+	if !pInt.ProbablyPrime(primalityRounds) || !q.ProbablyPrime(primalityRounds) {
+		return nil, &ValidationError{Field: "p", Code: CodeNotSafePrime, Message: "o módulo não é um primo seguro"}
+	}
+
+	// Para p = 2q + 1, g em [2, p-2] tem ordem q ou 2q; exigimos ordem 2q (g^q != 1)
+	pMinusOne := new(big.Int).Sub(pInt, one)
+	if !inRange(gInt, two, new(big.Int).Sub(pInt, two)) ||
+		new(big.Int).Exp(gInt, q, pInt).Cmp(one) == 0 {
+		return nil, &ValidationError{Field: "g", Code: CodeInvalidGenerator, Message: "g não é um gerador do grupo"}
+	}
+
+	if !inRange(yInt, two, new(big.Int).Sub(pMinusOne, one)) {
+		return nil, &ValidationError{Field: "y", Code: CodeOutOfRange, Message: "y deve estar no intervalo [2, p-2]"}
+	}
+
+	return &PublicKey{P: pInt, G: gInt, Y: yInt}, nil
+}
+
+// ValidatePublicKey verifica uma chave pública sem retornar os valores convertidos
+func ValidatePublicKey(p, g, y string) error {
+	_, err := ParsePublicKey(p, g, y)
+	return err
+}
+
+// ParseCiphertext converte um texto cifrado e verifica se ele foi gerado para o módulo
+// registrado do destinatário, com a e b no intervalo [1, p-1]
+func ParseCiphertext(a, b, p string, recipientP string) (*Ciphertext, error) {
+	if p != recipientP {
+		return nil, &ValidationError{Field: "p", Code: CodeKeyMismatch, Message: "o módulo não corresponde à chave do destinatário"}
+	}
+
+	pInt, err := parseInt("p", p)
+	if err != nil {
+		return nil, err
+	}
+	aInt, err := parseInt("a", a)
+	if err != nil {
+		return nil, err
+	}
+	bInt, err := parseInt("b", b)
+	if err != nil {
+		return nil, err
+	}
+
+	pMinusOne := new(big.Int).Sub(pInt, one)
+	if !inRange(aInt, one, pMinusOne) {
+		return nil, &ValidationError{Field: "a", Code: CodeOutOfRange, Message: "a deve estar no intervalo [1, p-1]"}
+	}
+	if !inRange(bInt, one, pMinusOne) {
+		return nil, &ValidationError{Field: "b", Code: CodeOutOfRange, Message: "b deve estar no intervalo [1, p-1]"}
+	}
+
+	return &Ciphertext{A: aInt, B: bInt, P: pInt}, nil
+}
+
+// ValidateCiphertext verifica um texto cifrado sem retornar os valores convertidos
+func ValidateCiphertext(a, b, p string, recipientP string) error {
+	_, err := ParseCiphertext(a, b, p, recipientP)
+	return err
+}
+
+// parseInt converte uma string decimal positiva em big.Int
+func parseInt(field, value string) (*big.Int, error) {
+	n, ok := new(big.Int).SetString(value, 10)
+	if !ok || n.Sign() <= 0 {
+		return nil, &ValidationError{Field: field, Code: CodeInvalidInteger, Message: "valor não é um inteiro decimal positivo"}
+	}
+	return n, nil
+}
+
+// inRange indica se min <= n <= max
+func inRange(n, min, max *big.Int) bool {
+	return n.Cmp(min) >= 0 && n.Cmp(max) <= 0
+}
@@ -0,0 +1,145 @@
+// Package keywrap valida os parâmetros com que o cliente cifra a chave privada com a senha
+package keywrap
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// Versões do registro. A versão 1 descreve as contas criadas com o salt fixo do cliente
+// e só é gravada pela migração; novos registros usam CurrentVersion.
+const (
+	LegacyVersion  = 1
+	CurrentVersion = 2
+)
+
+// Algoritmos aceitos
+const (
+	KDFPBKDF2SHA256 = "pbkdf2-sha256"
+	KDFArgon2id     = "argon2id"
+	CipherAES256GCM = "aes-256-gcm"
+)
+
+// Limites dos parâmetros. Os máximos evitam que um registro adulterado trave o cliente.
+const (
+	MinSaltBytes         = 16
+	MaxSaltBytes         = 64
+	MinPBKDF2Iterations  = 600000
+	MaxPBKDF2Iterations  = 10000000
+	MinArgon2Iterations  = 2
+	MaxArgon2Iterations  = 10
+	MinArgon2Memory      = 19456 // KiB
+	MaxArgon2Memory      = 1048576
+	MinArgon2Parallelism = 1
+	MaxArgon2Parallelism = 16
+)
+
+// legacyPBKDF2Iterations é o número de iterações fixo das contas da versão 1
+const legacyPBKDF2Iterations = 100000
+
+// Códigos de erro retornados nas validações
+const (
+	CodeUnsupportedVersion = "unsupported_version"
+	CodeUnsupportedKDF     = "unsupported_kdf"
+	CodeUnsupportedCipher  = "unsupported_cipher"
+	CodeInvalidSalt        = "invalid_salt"
+	CodeWeakParameters     = "weak_parameters"
+	CodeInvalidParameters  = "invalid_parameters"
+)
+
+// Params descreve como a chave privada foi cifrada: a KDF que deriva a chave a partir
+// da senha, seus parâmetros e a cifra usada
+type Params struct {
+	Version     int    `json:"version"`
+	KDF         string `json:"kdf"`
+	Salt        string `json:"salt"` // base64
+	Iterations  int    `json:"iterations"`
+	Memory      int    `json:"memory,omitempty"`      // KiB, apenas argon2id
+	Parallelism int    `json:"parallelism,omitempty"` // apenas argon2id
+	Cipher      string `json:"cipher"`
+}
+
+// Legacy retorna os parâmetros fixos usados pelo cliente antes do salt por usuário
+func Legacy() Params {
+	return Params{
+		Version:    LegacyVersion,
+		KDF:        KDFPBKDF2SHA256,
+		Salt:       base64.StdEncoding.EncodeToString([]byte("unique-salt")),
+		Iterations: legacyPBKDF2Iterations,
+		Cipher:     CipherAES256GCM,
+	}
+}
+
+// ValidationError descreve por que os parâmetros foram rejeitados
+type ValidationError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// WithPrefix retorna uma cópia do erro com o campo qualificado pelo prefixo
+func (e *ValidationError) WithPrefix(prefix string) *ValidationError {
+	return &ValidationError{
+		Field:   prefix + "." + e.Field,
+		Code:    e.Code,
+		Message: e.Message,
+	}
+}
+
+// Validate aceita apenas registros na versão atual com parâmetros dentro dos limites
+func Validate(p Params) error {
+	if p.Version != CurrentVersion {
+		return &ValidationError{"version", CodeUnsupportedVersion,
+			fmt.Sprintf("versão %d não suportada; use %d", p.Version, CurrentVersion)}
+	}
+
+	if p.Cipher != CipherAES256GCM {
+		return &ValidationError{"cipher", CodeUnsupportedCipher,
+			fmt.Sprintf("cifra %q não suportada; use %s", p.Cipher, CipherAES256GCM)}
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(p.Salt)
+	if err != nil {
+		return &ValidationError{"salt", CodeInvalidSalt, "salt deve estar em base64"}
+	}
+	if len(salt) < MinSaltBytes || len(salt) > MaxSaltBytes {
+		return &ValidationError{"salt", CodeInvalidSalt,
+			fmt.Sprintf("salt deve ter entre %d e %d bytes (recebido %d)", MinSaltBytes, MaxSaltBytes, len(salt))}
+	}
+
+	switch p.KDF {
+	case KDFPBKDF2SHA256:
+		if p.Memory != 0 || p.Parallelism != 0 {
+			return &ValidationError{"memory", CodeInvalidParameters, "memory e parallelism não se aplicam a " + KDFPBKDF2SHA256}
+		}
+		return checkRange("iterations", p.Iterations, MinPBKDF2Iterations, MaxPBKDF2Iterations)
+
+	case KDFArgon2id:
+		if err := checkRange("iterations", p.Iterations, MinArgon2Iterations, MaxArgon2Iterations); err != nil {
+			return err
+		}
+		if err := checkRange("memory", p.Memory, MinArgon2Memory, MaxArgon2Memory); err != nil {
+			return err
+		}
+		return checkRange("parallelism", p.Parallelism, MinArgon2Parallelism, MaxArgon2Parallelism)
+
+	default:
+		return &ValidationError{"kdf", CodeUnsupportedKDF,
+			fmt.Sprintf("KDF %q não suportada; use %s ou %s", p.KDF, KDFPBKDF2SHA256, KDFArgon2id)}
+	}
+}
+
+// checkRange rejeita valores abaixo do mínimo como fracos e acima do máximo como inválidos
+func checkRange(field string, value, min, max int) error {
+	if value < min {
+		return &ValidationError{field, CodeWeakParameters, fmt.Sprintf("%s deve ser ao menos %d", field, min)}
+	}
+	if value > max {
+		return &ValidationError{field, CodeInvalidParameters, fmt.Sprintf("%s deve ser no máximo %d", field, max)}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package keywrap
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func validPBKDF2() Params {
+	return Params{
+		Version:    CurrentVersion,
+		KDF:        KDFPBKDF2SHA256,
+		Salt:       base64.StdEncoding.EncodeToString(make([]byte, 16)),
+		Iterations: MinPBKDF2Iterations,
+		Cipher:     CipherAES256GCM,
+	}
+}
+
+func validArgon2id() Params {
+	return Params{
+		Version:     CurrentVersion,
+		KDF:         KDFArgon2id,
+		Salt:        base64.StdEncoding.EncodeToString(make([]byte, 16)),
+		Iterations:  MinArgon2Iterations,
+		Memory:      MinArgon2Memory,
+		Parallelism: MinArgon2Parallelism,
+		Cipher:      CipherAES256GCM,
+	}
+}
+
+func TestValidateAcceptsCurrentParams(t *testing.T) {
+	for name, p := range map[string]Params{"pbkdf2": validPBKDF2(), "argon2id": validArgon2id()} {
+		if err := Validate(p); err != nil {
+			t.Errorf("%s rejeitado: %v", name, err)
+		}
+	}
+}
+
+func TestValidateRejectsWeakOrInvalidParams(t *testing.T) {
+	with := func(p Params, change func(*Params)) Params {
+		change(&p)
+		return p
+	}
+
+	tests := []struct {
+		name  string
+		p     Params
+		field string
+		code  string
+	}{
+		{"registro legado", Legacy(), "version", CodeUnsupportedVersion},
+		{"cifra desconhecida", with(validPBKDF2(), func(p *Params) { p.Cipher = "aes-128-cbc" }), "cipher", CodeUnsupportedCipher},
+		{"salt fora de base64", with(validPBKDF2(), func(p *Params) { p.Salt = "@@" }), "salt", CodeInvalidSalt},
+		{"salt curto", with(validPBKDF2(), func(p *Params) { p.Salt = base64.StdEncoding.EncodeToString(make([]byte, 8)) }), "salt", CodeInvalidSalt},
+		{"poucas iterações", with(validPBKDF2(), func(p *Params) { p.Iterations = 100000 }), "iterations", CodeWeakParameters},
+		{"iterações demais", with(validPBKDF2(), func(p *Params) { p.Iterations = MaxPBKDF2Iterations + 1 }), "iterations", CodeInvalidParameters},
+		{"memória em pbkdf2", with(validPBKDF2(), func(p *Params) { p.Memory = MinArgon2Memory }), "memory", CodeInvalidParameters},
+		{"pouca memória", with(validArgon2id(), func(p *Params) { p.Memory = 1024 }), "memory", CodeWeakParameters},
+		{"sem paralelismo", with(validArgon2id(), func(p *Params) { p.Parallelism = 0 }), "parallelism", CodeWeakParameters},
+		{"kdf desconhecida", with(validPBKDF2(), func(p *Params) { p.KDF = "scrypt" }), "kdf", CodeUnsupportedKDF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var validationErr *ValidationError
+			if err := Validate(tt.p); !errors.As(err, &validationErr) {
+				t.Fatalf("erro = %v, esperado ValidationError", err)
+			}
+			if validationErr.Field != tt.field || validationErr.Code != tt.code {
+				t.Errorf("erro = %s/%s, esperado %s/%s", validationErr.Field, validationErr.Code, tt.field, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Package totp implementa senhas de uso único baseadas em tempo (RFC 6238) com HMAC-SHA1,
+// o formato aceito pelos aplicativos autenticadores
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parâmetros fixos, os padrões dos aplicativos autenticadores
+const (
+	Digits      = 6
+	Period      = 30 * time.Second
+	SecretBytes = 20
+	// Skew é quantos passos antes ou depois do atual ainda são aceitos, para relógios defasados
+	Skew = 1
+)
+
+var ErrInvalidSecret = errors.New("segredo TOTP inválido")
+
+// encoding é o base32 sem preenchimento usado nos URIs otpauth
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret gera um segredo aleatório, codificado em base32
+func GenerateSecret() (string, error) {
+	raw := make([]byte, SecretBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(raw), nil
+}
+
+// decodeSecret aceita o segredo em base32 com ou sem preenchimento e em minúsculas
+func decodeSecret(secret string) ([]byte, error) {
+	key, err := encoding.DecodeString(strings.TrimRight(strings.ToUpper(secret), "="))
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+	return key, nil
+}
+
+// Step retorna o passo de tempo que contém t
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// codeAt calcula o código do passo conforme a RFC 4226, seção 5.3
+func codeAt(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%mod)
+}
+
+// Code retorna o código válido no instante t
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return codeAt(key, Step(t)), nil
+}
+
+// Validate confere o código contra os passos em torno de t e retorna o passo aceito.
+// Quem chama deve recusar passos já usados, evitando que o mesmo código valha duas vezes.
+func Validate(secret, code string, t time.Time) (int64, bool) {
+	key, err := decodeSecret(secret)
+	if err != nil || len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(t)
+	for step := current - Skew; step <= current+Skew; step++ {
+		if subtle.ConstantTimeCompare([]byte(codeAt(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// ProvisioningURI monta o URI otpauth://totp exibido como QR code para cadastrar o segredo
+func ProvisioningURI(issuer, account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(Digits))
+	params.Set("period", fmt.Sprint(int(Period/time.Second)))
+
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
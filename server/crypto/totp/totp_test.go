@@ -0,0 +1,78 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret é a chave SHA-1 dos vetores de teste do apêndice B da RFC 6238
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestRFC6238Vectors(t *testing.T) {
+	// Os vetores da RFC têm 8 dígitos; os 6 últimos são o código de 6 dígitos
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, v := range vectors {
+		code, err := Code(rfcSecret, time.Unix(v.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != v.code {
+			t.Errorf("t=%d: código = %s, esperado %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestValidateAcceptsSkewAndReturnsStep(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	previous, _ := Code(rfcSecret, now.Add(-Period))
+	step, ok := Validate(rfcSecret, previous, now)
+	if !ok || step != Step(now)-1 {
+		t.Errorf("código do passo anterior: passo = %d, ok = %v", step, ok)
+	}
+
+	old, _ := Code(rfcSecret, now.Add(-2*Period))
+	if _, ok := Validate(rfcSecret, old, now); ok {
+		t.Error("código fora da tolerância aceito")
+	}
+
+	for _, code := range []string{"", "12345", "abcdef", "0000000"} {
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("código %q aceito", code)
+		}
+	}
+}
+
+func TestGenerateSecretAndURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Code(secret, time.Now()); err != nil {
+		t.Fatalf("segredo gerado inválido: %v", err)
+	}
+
+	uri, err := url.Parse(ProvisioningURI("Chat E2EE", "alice", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Chat E2EE:alice" {
+		t.Errorf("URI inesperado: %s", uri)
+	}
+	if uri.Query().Get("secret") != secret || uri.Query().Get("issuer") != "Chat E2EE" {
+		t.Errorf("parâmetros inesperados: %s", uri.RawQuery)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"server/config"
 	"server/routes"
+	"server/services"
 	"server/websocket"
 	"time"
 
@@ -19,10 +20,16 @@ func main() {
 	// Inicializar o banco de dados
 	config.InitDatabase()
 
+	// Carregar as chaves de assinatura dos tokens
+	config.InitJWT()
+
 	// Criar e iniciar o Hub do WebSocket
 	hub := websocket.NewHub()
 	go hub.Run()
 
+	// Remover mensagens temporárias expiradas e avisar os clientes
+	services.StartMessageSweeper(services.MessageSweepInterval, hub.NotifyMessagesExpired)
+
 	// Configurar o router
 	router := gin.Default()
 
@@ -5,10 +5,9 @@ import (
 	"net/http"
 	"strings"
 
-	"server/config"
+	"server/services"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 )
 
 func AuthMiddleware() gin.HandlerFunc {
@@ -24,26 +23,24 @@ func AuthMiddleware() gin.HandlerFunc {
 		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
 
 		// Validar o token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return config.JWTSecret, nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := services.ParseAccessToken(tokenString)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
 			c.Abort()
 			return
 		}
 
-		// Extrair claims do token
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+		// Sessões encerradas invalidam o token antes da expiração
+		if err := services.RequireActiveSession(claims.UserID, claims.SessionID); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Sessão encerrada"})
 			c.Abort()
 			return
 		}
 
-		// Adicionar o ID do usuário ao contexto
-		c.Set("user_id", claims["user_id"])
+		// Adicionar o usuário e a sessão ao contexto
+		c.Set("user_id", claims.UserID)
+		c.Set("session_id", claims.SessionID)
+		c.Set("token_expires_at", claims.ExpiresAt)
 		c.Next()
 	}
 }
\ No newline at end of file
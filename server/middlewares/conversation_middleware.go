@@ -0,0 +1,38 @@
+// server/middlewares/conversation_middleware.go
+package middlewares
+
+import (
+	"net/http"
+
+	"server/services"
+	"server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConversationParticipant garante que o usuário autenticado participa da conversa do parâmetro :id
+func ConversationParticipant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		ok, err := services.IsParticipant(c.Param("id"), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao verificar participação na conversa"})
+			c.Abort()
+			return
+		}
+
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Você não participa desta conversa"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
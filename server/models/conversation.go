@@ -7,19 +7,30 @@ import (
 )
 
 type Conversation struct {
-	ID        string    `gorm:"primaryKey" json:"id"`
-	Type      string    `gorm:"not null" json:"type"` // GROUP ou DIRECT
-	CreatedAt time.Time `json:"created_at"`
+	ID                  string    `gorm:"primaryKey" json:"id"`
+	Type                string    `gorm:"not null" json:"type"`                           // GROUP ou DIRECT
+	DisappearingSeconds int64     `gorm:"not null;default:0" json:"disappearing_seconds"` // 0 desativa as mensagens temporárias
+	LastSeq             int64     `gorm:"not null;default:0" json:"last_seq"`             // Sequência da mensagem mais recente da conversa
+	LastChangeSeq       int64     `gorm:"not null;default:0" json:"last_change_seq"`      // Sequência da edição ou exclusão mais recente
+	CreatedAt           time.Time `json:"created_at"`
 
 	// Relacionamentos
 	Participants []ConversationParticipant `gorm:"foreignKey:ConversationID"`
 	Messages     []Message                 `gorm:"foreignKey:ConversationID"`
 }
 
+// Papéis de um participante dentro de um grupo
+const (
+	RoleOwner  = "OWNER"
+	RoleAdmin  = "ADMIN"
+	RoleMember = "MEMBER"
+)
+
 type ConversationParticipant struct {
 	ID             string    `gorm:"primaryKey" json:"id"`
 	ConversationID string    `gorm:"index;not null" json:"conversation_id"`
 	UserID         string    `gorm:"index;not null" json:"user_id"`
+	Role           string    `gorm:"not null;default:MEMBER" json:"role"` // OWNER, ADMIN ou MEMBER
 	JoinedAt       time.Time `json:"joined_at"`
 
 	// Relacionamentos
@@ -27,6 +38,11 @@ type ConversationParticipant struct {
 	User         User        `gorm:"foreignKey:UserID"`
 }
 
+// IsAdmin indica se o participante pode administrar o grupo
+func (p ConversationParticipant) IsAdmin() bool {
+	return p.Role == RoleOwner || p.Role == RoleAdmin
+}
+
 type ConversationParticipants []ConversationParticipant
 
 func (p ConversationParticipants) GetUserIDs() []string {
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Device representa um dispositivo do usuário com seu próprio par de chaves ElGamal
+type Device struct {
+	ID        string        `gorm:"primaryKey" json:"id"`
+	UserID    string        `gorm:"index;not null" json:"userId"`
+	Name      string        `gorm:"not null" json:"name"`
+	PublicKey PublicKeyData `gorm:"serializer:json" json:"publicKey"`
+	CreatedAt time.Time     `json:"createdAt"`
+	RevokedAt *time.Time    `json:"revokedAt,omitempty"`
+
+	// Relacionamentos
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// IsRevoked indica se o dispositivo foi revogado e não deve mais receber mensagens
+func (d Device) IsRevoked() bool {
+	return d.RevokedAt != nil
+}
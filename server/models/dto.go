@@ -8,6 +8,8 @@ type ConversationDTO struct {
     Type         string           `json:"type"`
     Name         string           `json:"name"`
     CreatedAt    time.Time        `json:"createdAt"`
+    Epoch        int64            `json:"epoch"` // Época atual do grupo; 0 em conversas diretas
+    DisappearingSeconds int64     `json:"disappearingSeconds"`
     Participants []ParticipantDTO `json:"participants"`
     Messages     []MessageDTO     `json:"messages,omitempty"`
 }
@@ -16,12 +18,30 @@ type ParticipantDTO struct {
     ID        string       `json:"id"`
     Username  string       `json:"username"`
     PublicKey PublicKeyData `json:"publicKey,omitempty"`
+    Role      string       `json:"role,omitempty"`
+    Devices   []DeviceDTO  `json:"devices"`
+}
+
+type DeviceDTO struct {
+    ID        string        `json:"id"`
+    Name      string        `json:"name"`
+    PublicKey PublicKeyData `json:"publicKey"`
 }
 
 type MessageDTO struct {
     ID        string         `json:"id"`
+    Seq       int64          `json:"seq"`
     SenderID  string         `json:"senderId"`
+    ClientMessageID *string  `json:"clientMessageId,omitempty"`
+    Type      string         `json:"type"`
+    System    *SystemEvent   `json:"system,omitempty"`
     CreatedAt time.Time      `json:"createdAt"`
     Content   ElGamalContent `json:"content"`
     Status    string         `json:"status"`
+    Version   int            `json:"version"`
+    Epoch     int64          `json:"epoch"`
+    SenderKeyContent *SenderKeyContent `json:"senderKeyContent,omitempty"`
+    EditedAt  *time.Time     `json:"editedAt,omitempty"`
+    DeletedAt *time.Time     `json:"deletedAt,omitempty"`
+    ExpiresAt *time.Time     `json:"expiresAt,omitempty"`
 }
\ No newline at end of file
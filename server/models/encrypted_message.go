@@ -8,10 +8,24 @@ import (
 	"fmt"
 )
 
+// ElGamalContent guarda o conteúdo cifrado para um destinatário.
+// No formato legado (v ausente ou 1) a mensagem é cifrada diretamente em (a, b).
+// No envelope híbrido (v = 2), (a, b) encapsulam a chave e ct traz o corpo em AES-256-GCM.
 type ElGamalContent struct {
-	A string `json:"a"`
-	B string `json:"b"`
-	P string `json:"p"`
+	V     int    `json:"v,omitempty"`
+	A     string `json:"a"`
+	B     string `json:"b"`
+	P     string `json:"p"`
+	Nonce string `json:"nonce,omitempty"`
+	CT    string `json:"ct,omitempty"`
+}
+
+// Version retorna a versão do formato, tratando a ausência como legado
+func (e ElGamalContent) Version() int {
+	if e.V == 0 {
+		return 1
+	}
+	return e.V
 }
 
 // Implementa a interface driver.Valuer para converter ElGamalContent em JSON
@@ -6,10 +6,27 @@ import "time"
 type Group struct {
 	ConversationID string `gorm:"primaryKey" json:"conversationId"`
 	Name           string `gorm:"not null" json:"name"`
-	AdminID        string `gorm:"index;not null" json:"adminId"`
+	AdminID        string `gorm:"index;not null" json:"adminId"` // Dono do grupo (papel OWNER)
+	Epoch          int64  `gorm:"not null;default:0" json:"epoch"` // Incrementado a cada mudança de membros
 	CreatedAt      time.Time `json:"createdAt"`
 
+	// Configurações
+	OnlyAdminsCanPost       bool `gorm:"not null;default:false" json:"onlyAdminsCanPost"`
+	OnlyAdminsCanAddMembers bool `gorm:"not null;default:false" json:"onlyAdminsCanAddMembers"`
+	SenderKeyMode           bool `gorm:"not null;default:false" json:"senderKeyMode"` // Mensagens cifradas uma vez com chaves de remetente
+
 	// Relacionamentos
 	Conversation Conversation `gorm:"foreignKey:ConversationID"`
 	Admin        User        `gorm:"foreignKey:AdminID"`
-}
\ No newline at end of file
+}
+
+// GroupEpoch registra a composição do grupo em cada época
+type GroupEpoch struct {
+	ID             string    `gorm:"primaryKey" json:"id"`
+	ConversationID string    `gorm:"uniqueIndex:idx_group_epoch;not null" json:"conversationId"`
+	Epoch          int64     `gorm:"uniqueIndex:idx_group_epoch;not null" json:"epoch"`
+	MemberIDs      []string  `gorm:"serializer:json" json:"memberIds"`
+	Reason         string    `gorm:"not null" json:"reason"` // created, members_added, members_removed ou member_left
+	ActorID        string    `json:"actorId"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
@@ -4,25 +4,63 @@ import (
 	"time"
 )
 
+// Tipos de mensagem
+const (
+	MessageTypeUser   = "USER"
+	MessageTypeSystem = "SYSTEM" // Gerada pelo servidor, sem conteúdo cifrado
+)
+
+// Status de uma mensagem para cada destinatário, em ordem de progresso
+const (
+	StatusSent      = "SENT"
+	StatusDelivered = "DELIVERED" // Escrita em uma conexão do destinatário
+	StatusRead      = "READ"
+)
+
+// Eventos registrados em mensagens de sistema
+const (
+	SystemEventTimerChanged = "timer_changed"
+)
+
+// SystemEvent descreve o conteúdo em claro de uma mensagem de sistema
+type SystemEvent struct {
+	Event               string `json:"event"`
+	ActorID             string `json:"actorId"`
+	DisappearingSeconds int64  `json:"disappearingSeconds"`
+}
+
 type Message struct {
-	ID             string    `gorm:"primaryKey" json:"id"`
-	ConversationID string    `gorm:"index;not null" json:"conversationId"`
-	SenderID       string    `gorm:"index;not null" json:"senderId"`
-	CreatedAt      time.Time `json:"createdAt"`
+	ID               string            `gorm:"primaryKey" json:"id"`
+	ConversationID   string            `gorm:"index;not null" json:"conversationId"`
+	Seq              int64             `gorm:"not null;default:0" json:"seq"` // Posição na conversa, sem lacunas; único com ConversationID
+	SenderID         string            `gorm:"index;uniqueIndex:idx_sender_client_message;not null" json:"senderId"`
+	ClientMessageID  *string           `gorm:"uniqueIndex:idx_sender_client_message" json:"clientMessageId,omitempty"` // Chave de idempotência informada pelo cliente
+	Type             string            `gorm:"not null;default:USER" json:"type"`                                      // USER ou SYSTEM
+	System           *SystemEvent      `gorm:"serializer:json" json:"system,omitempty"`
+	Version          int               `gorm:"not null;default:1" json:"version"`                 // Formato do conteúdo cifrado
+	Epoch            int64             `gorm:"not null;default:0" json:"epoch"`                   // Época do grupo no envio; 0 em conversas diretas
+	SenderKeyContent *SenderKeyContent `gorm:"serializer:json" json:"senderKeyContent,omitempty"` // Presente apenas no modo de chave de remetente
+	CreatedAt        time.Time         `json:"createdAt"`
+	EditedAt         *time.Time        `json:"editedAt,omitempty"`
+	DeletedAt        *time.Time        `json:"deletedAt,omitempty"`                 // Mensagens apagadas permanecem como registro sem conteúdo
+	ExpiresAt        *time.Time        `gorm:"index" json:"expiresAt,omitempty"`    // Mensagens temporárias são removidas após esta data
+	ChangeSeq        int64             `gorm:"not null;default:0" json:"changeSeq"` // Posição da última edição ou exclusão na conversa; 0 se nunca alterada
 
 	// Relacionamentos
 	Conversation Conversation       `gorm:"foreignKey:ConversationID"`
-	Sender       User              `gorm:"foreignKey:SenderID"`
+	Sender       User               `gorm:"foreignKey:SenderID"`
 	Recipients   []MessageRecipient `gorm:"foreignKey:MessageID"`
 }
 
 type MessageRecipient struct {
-	ID               string        `gorm:"primaryKey" json:"id"`
-	MessageID        string        `gorm:"index;not null" json:"messageId"`
-	RecipientID      string        `gorm:"index;not null" json:"recipientId"`
+	ID               string         `gorm:"primaryKey" json:"id"`
+	MessageID        string         `gorm:"index;not null" json:"messageId"`
+	RecipientID      string         `gorm:"index;not null" json:"recipientId"`
+	DeviceID         string         `gorm:"index" json:"deviceId,omitempty"` // Vazio quando cifrado para a chave do usuário
 	EncryptedContent ElGamalContent `gorm:"type:jsonb" json:"encryptedContent"`
-	Status           string        `gorm:"not null" json:"status"`
-	StatusUpdatedAt  time.Time     `json:"statusUpdatedAt"`
+	Status           string         `gorm:"not null" json:"status"`
+	StatusUpdatedAt  time.Time      `json:"statusUpdatedAt"`
+	ExpiresAt        *time.Time     `gorm:"index" json:"expiresAt,omitempty"`
 
 	// Relacionamentos
 	Message   Message `gorm:"foreignKey:MessageID"`
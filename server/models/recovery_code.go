@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// RecoveryCode é um código de uso único que substitui o TOTP quando o usuário perde o
+// autenticador. Apenas o hash é guardado.
+type RecoveryCode struct {
+	ID        string     `gorm:"primaryKey" json:"id"`
+	UserID    string     `gorm:"index;not null" json:"userId"`
+	CodeHash  string     `gorm:"uniqueIndex;not null" json:"-"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+
+	// Relacionamentos
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
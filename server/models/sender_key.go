@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// SenderKeyContent é o corpo de uma mensagem de grupo cifrado uma única vez com a
+// chave de remetente (AES-256-GCM) identificada por KeyID
+type SenderKeyContent struct {
+	KeyID string `json:"keyId"`
+	Nonce string `json:"nonce"`
+	CT    string `json:"ct"`
+}
+
+// SenderKeyDistribution guarda a chave de remetente de um membro cifrada com a
+// chave ElGamal de outro membro, válida para uma época do grupo
+type SenderKeyDistribution struct {
+	ID             string         `gorm:"primaryKey" json:"id"`
+	ConversationID string         `gorm:"uniqueIndex:idx_sender_key_distribution;not null" json:"conversationId"`
+	SenderID       string         `gorm:"uniqueIndex:idx_sender_key_distribution;not null" json:"senderId"`
+	RecipientID    string         `gorm:"uniqueIndex:idx_sender_key_distribution;index;not null" json:"recipientId"`
+	Epoch          int64          `gorm:"uniqueIndex:idx_sender_key_distribution;not null" json:"epoch"`
+	KeyID          string         `gorm:"not null" json:"keyId"`
+	WrappedKey     ElGamalContent `gorm:"type:jsonb" json:"wrappedKey"`
+	CreatedAt      time.Time      `json:"createdAt"`
+}
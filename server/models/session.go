@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Session representa um login ativo. O refresh token é guardado apenas como hash
+// e trocado a cada renovação; o access token carrega o ID da sessão.
+type Session struct {
+	ID                  string     `gorm:"primaryKey" json:"id"`
+	UserID              string     `gorm:"index;not null" json:"userId"`
+	RefreshTokenHash    string     `gorm:"uniqueIndex;not null" json:"-"`
+	PreviousRefreshHash string     `gorm:"index" json:"-"` // Refresh token anterior; reapresentá-lo indica vazamento
+	UserAgent           string     `json:"userAgent"`
+	IP                  string     `json:"ip"`
+	CreatedAt           time.Time  `json:"createdAt"`
+	LastUsedAt          time.Time  `json:"lastUsedAt"`
+	ExpiresAt           time.Time  `json:"expiresAt"` // Expiração do refresh token atual
+	RevokedAt           *time.Time `json:"revokedAt,omitempty"`
+
+	// Relacionamentos
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// IsActive indica se a sessão ainda pode ser usada
+func (s Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
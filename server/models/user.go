@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"server/crypto/keywrap"
 )
 
 // User representa um usuário do sistema
@@ -10,12 +12,18 @@ type User struct {
 	Username            string         `json:"username" gorm:"unique"`
 	PasswordHash        string         `json:"-"`
 	EncryptedPrivateKey string         `json:"encryptedPrivateKey"`
+	KeyWrap             keywrap.Params `json:"keyWrap" gorm:"serializer:json"` // Como a chave privada foi cifrada com a senha
 	PublicKey           PublicKeyData  `json:"publicKey" gorm:"serializer:json"`
 	CreatedAt           time.Time      `json:"createdAt"`
-	LastSeen           time.Time      `json:"lastSeen"`
+	LastSeen            time.Time      `json:"lastSeen"`
+	HideLastSeen        bool           `json:"hideLastSeen" gorm:"not null;default:false"` // Oculta o último acesso dos outros usuários
+	TOTPSecret          string         `json:"-"`                                          // Base32; pendente até TOTPEnabled
+	TOTPEnabled         bool           `json:"totpEnabled" gorm:"not null;default:false"`
+	TOTPLastStep        int64          `json:"-"` // Último passo aceito, para que um código não valha duas vezes
 
 	// Relacionamentos
-	Contacts []Contact `gorm:"foreignKey:UserID"`
+	Contacts                 []Contact                 `gorm:"foreignKey:UserID"`
+	Devices                  []Device                  `gorm:"foreignKey:UserID" json:"-"`
 	ConversationParticipants []ConversationParticipant `gorm:"foreignKey:UserID"`
 }
 
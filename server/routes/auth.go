@@ -11,5 +11,8 @@ func AuthRoutes(router *gin.Engine) {
 	{
 		auth.POST("/register", controllers.RegisterUser)
 		auth.POST("/login", controllers.LoginUser)
+		auth.POST("/login/2fa", controllers.LoginTwoFactor)
+		auth.POST("/refresh", controllers.RefreshToken)
+		auth.POST("/logout", controllers.Logout)
 	}
 }
\ No newline at end of file
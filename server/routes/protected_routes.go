@@ -12,7 +12,39 @@ func ProtectedRoutes(router *gin.Engine) {
 	{
 		// Rotas de chaves
 		protected.PUT("/user/keys", controllers.UpdateKeys)
+		protected.POST("/user/password", controllers.ChangePassword)
 		protected.GET("/user/:id/public-key", controllers.GetPublicKey)
+		protected.GET("/user/:id/devices", controllers.ListUserDevices)
+		protected.GET("/user/privacy", controllers.GetPrivacySettings)
+		protected.PATCH("/user/privacy", controllers.UpdatePrivacySettings)
+
+		// Rotas de autenticação em dois fatores
+		twoFactor := protected.Group("/user/2fa")
+		{
+			twoFactor.GET("", controllers.GetTwoFactorStatus)
+			twoFactor.POST("/setup", controllers.SetupTwoFactor)
+			twoFactor.POST("/enable", controllers.EnableTwoFactor)
+			twoFactor.POST("/disable", controllers.DisableTwoFactor)
+			twoFactor.POST("/recovery-codes", controllers.RegenerateRecoveryCodes)
+		}
+
+		// Rotas de dispositivos
+		devices := protected.Group("/devices")
+		{
+			devices.GET("", controllers.ListDevices)
+			devices.POST("", controllers.AddDevice)
+			devices.DELETE("/:id", controllers.RevokeDevice)
+		}
+
+		// Rotas de sessões
+		sessions := protected.Group("/sessions")
+		{
+			sessions.GET("", controllers.ListSessions)
+			sessions.DELETE("/:id", controllers.RevokeSession)
+		}
+
+		// Ticket de autenticação do WebSocket
+		protected.POST("/ws/ticket", controllers.CreateWSTicket)
 
 		// Rotas de contatos
 		contacts := protected.Group("/contacts")
@@ -27,15 +59,34 @@ func ProtectedRoutes(router *gin.Engine) {
 		groups := protected.Group("/groups")
 		{
 			groups.POST("", controllers.CreateGroup)
+			groups.PATCH("/:id", controllers.UpdateGroup)
+			groups.POST("/:id/members", controllers.AddGroupMembers)
+			groups.DELETE("/:id/members", controllers.RemoveGroupMembers)
+			groups.POST("/:id/leave", controllers.LeaveGroup)
+			groups.POST("/:id/members/:userId/promote", controllers.PromoteGroupMember)
+			groups.POST("/:id/members/:userId/demote", controllers.DemoteGroupMember)
+			groups.POST("/:id/transfer", controllers.TransferGroupOwnership)
+			groups.GET("/:id/epochs", middlewares.ConversationParticipant(), controllers.ListGroupEpochs)
+			groups.GET("/:id/sender-keys", middlewares.ConversationParticipant(), controllers.ListSenderKeys)
+			groups.POST("/:id/sender-keys", middlewares.ConversationParticipant(), controllers.DistributeSenderKey)
 		}
 
 		// Rotas de conversas
 		conversations := protected.Group("/conversations")
 		{
 			conversations.GET("", controllers.ListConversations)
-			conversations.GET("/:id", controllers.GetConversation)
-			conversations.POST("/:id/messages", controllers.SendMessage)
-			conversations.PATCH("/:id/messages/:messageId/status", controllers.UpdateMessageStatus)
+
+			// Rotas de uma conversa específica exigem que o usuário participe dela
+			conversation := conversations.Group("/:id", middlewares.ConversationParticipant())
+			{
+				conversation.GET("", controllers.GetConversation)
+				conversation.PATCH("/timer", controllers.SetDisappearingTimer)
+				conversation.GET("/messages", controllers.ListMessages)
+				conversation.POST("/messages", controllers.SendMessage)
+				conversation.PATCH("/messages/:messageId", controllers.EditMessage)
+				conversation.DELETE("/messages/:messageId", controllers.DeleteMessage)
+				conversation.PATCH("/messages/:messageId/status", controllers.UpdateMessageStatus)
+			}
 		}
 	}
 }
\ No newline at end of file
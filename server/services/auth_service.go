@@ -2,11 +2,15 @@
 package services
 
 import (
+	"errors"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
-	"golang.org/x/crypto/bcrypt"
 	"server/config"
+	"server/crypto/keywrap"
+	"server/models"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // HashPassword cria um hash a partir de uma senha fornecida
@@ -20,17 +24,109 @@ func CheckPasswordHash(password, hash string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
 
-// GenerateJWT gera um token JWT para um usuário específico
-func GenerateJWT(userID string) (string, error) {
-	// Definir as declarações/claims
-	claims := jwt.MapClaims{}
-	claims["authorized"] = true
-	claims["user_id"] = userID
-	claims["exp"] = time.Now().Add(time.Hour * 72).Unix() // Validade de 72 horas
+// ErrWrongPassword indica que a senha atual informada não confere
+var ErrWrongPassword = errors.New("senha atual incorreta")
+
+// ErrKeyWrapUpToDate indica que a chave privada já usa os parâmetros atuais e só pode ser
+// recifrada junto da troca de senha
+var ErrKeyWrapUpToDate = errors.New("a chave privada já usa os parâmetros atuais; use a troca de senha")
 
-	// Criar o token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+// ChangePassword troca a senha do usuário e a chave privada recifrada com ela numa única
+// transação, revogando as demais sessões. Retorna as sessões revogadas.
+func ChangePassword(userID, currentSessionID, oldPassword, newPassword, encryptedPrivateKey string, keyWrap keywrap.Params) ([]string, error) {
+	newHash, err := HashPassword(newPassword)
+	if err != nil {
+		return nil, err
+	}
 
-	// Assinar o token com a chave secreta do config
-	return token.SignedString(config.JWTSecret)
-}
\ No newline at end of file
+	var revoked []string
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Select("id", "password_hash").First(&user, "id = ?", userID).Error; err != nil {
+			return err
+		}
+		if CheckPasswordHash(oldPassword, user.PasswordHash) != nil {
+			return ErrWrongPassword
+		}
+
+		// A troca só vale se o hash não mudou desde a verificação
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND password_hash = ?", userID, user.PasswordHash).
+			Select("PasswordHash", "EncryptedPrivateKey", "KeyWrap").
+			Updates(models.User{
+				PasswordHash:        newHash,
+				EncryptedPrivateKey: encryptedPrivateKey,
+				KeyWrap:             keyWrap,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrWrongPassword
+		}
+
+		if err := tx.Model(&models.Session{}).
+			Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, currentSessionID).
+			Pluck("id", &revoked).Error; err != nil {
+			return err
+		}
+		if len(revoked) == 0 {
+			return nil
+		}
+		return tx.Model(&models.Session{}).
+			Where("id IN ?", revoked).
+			Update("revoked_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return revoked, nil
+}
+
+// KeyUpdate reúne a chave privada recifrada e, numa rotação, a nova chave pública
+type KeyUpdate struct {
+	EncryptedPrivateKey string
+	KeyWrap             keywrap.Params
+	PublicKey           *models.PublicKeyData // nil apenas recifra a chave privada atual
+}
+
+// UpdateKeys grava as chaves do usuário conferindo a senha na mesma transação. Com PublicKey,
+// troca o par de chaves; sem ela, apenas migra a cifragem de uma conta com os parâmetros
+// legados, pois as demais recifragens passam por ChangePassword.
+func UpdateKeys(userID, password string, update KeyUpdate) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Select("id", "password_hash", "key_wrap").First(&user, "id = ?", userID).Error; err != nil {
+			return err
+		}
+		if CheckPasswordHash(password, user.PasswordHash) != nil {
+			return ErrWrongPassword
+		}
+		if update.PublicKey == nil && user.KeyWrap.Version != keywrap.LegacyVersion {
+			return ErrKeyWrapUpToDate
+		}
+
+		fields := []string{"EncryptedPrivateKey", "KeyWrap"}
+		values := models.User{
+			EncryptedPrivateKey: update.EncryptedPrivateKey,
+			KeyWrap:             update.KeyWrap,
+		}
+		if update.PublicKey != nil {
+			fields = append(fields, "PublicKey")
+			values.PublicKey = *update.PublicKey
+		}
+
+		// A troca só vale se a senha não mudou desde a verificação
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND password_hash = ?", userID, user.PasswordHash).
+			Select(fields).
+			Updates(values)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrWrongPassword
+		}
+		return nil
+	})
+}
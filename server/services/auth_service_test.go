@@ -0,0 +1,78 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"server/config"
+	"server/crypto/keywrap"
+	"server/models"
+)
+
+func loadTestUser(t *testing.T, userID string) models.User {
+	t.Helper()
+
+	var user models.User
+	if err := config.DB.First(&user, "id = ?", userID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestUpdateKeysRotatesKeyPair(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice")
+
+	rotated := models.PublicKeyData{P: alice.PublicKey.P, G: alice.PublicKey.G, Y: "12345"}
+	update := KeyUpdate{
+		EncryptedPrivateKey: "nova-chave-cifrada",
+		KeyWrap:             keywrap.Params{Version: keywrap.CurrentVersion, Salt: "novo-salt"},
+		PublicKey:           &rotated,
+	}
+
+	if err := UpdateKeys(alice.ID, "errada", update); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("senha errada: erro = %v, esperado ErrWrongPassword", err)
+	}
+	if loadTestUser(t, alice.ID).PublicKey != alice.PublicKey {
+		t.Fatal("chave pública trocada com a senha errada")
+	}
+
+	// A rotação vale mesmo para contas que já usam os parâmetros atuais
+	if err := UpdateKeys(alice.ID, "senha", update); err != nil {
+		t.Fatal(err)
+	}
+	user := loadTestUser(t, alice.ID)
+	if user.PublicKey != rotated || user.EncryptedPrivateKey != update.EncryptedPrivateKey || user.KeyWrap.Salt != "novo-salt" {
+		t.Errorf("chaves gravadas: publicKey = %+v, encryptedPrivateKey = %q, keyWrap = %+v", user.PublicKey, user.EncryptedPrivateKey, user.KeyWrap)
+	}
+}
+
+func TestUpdateKeysRewrapsOnlyLegacyAccounts(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice")
+	update := KeyUpdate{
+		EncryptedPrivateKey: "chave-recifrada",
+		KeyWrap:             keywrap.Params{Version: keywrap.CurrentVersion, Salt: "novo-salt"},
+	}
+
+	// Sem chave pública, contas já migradas recifram apenas pela troca de senha
+	if err := UpdateKeys(alice.ID, "senha", update); !errors.Is(err, ErrKeyWrapUpToDate) {
+		t.Fatalf("conta migrada: erro = %v, esperado ErrKeyWrapUpToDate", err)
+	}
+
+	if err := config.DB.Model(&models.User{}).Where("id = ?", alice.ID).
+		Select("KeyWrap").Updates(models.User{KeyWrap: keywrap.Legacy()}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateKeys(alice.ID, "senha", update); err != nil {
+		t.Fatal(err)
+	}
+
+	user := loadTestUser(t, alice.ID)
+	if user.KeyWrap.Version != keywrap.CurrentVersion || user.EncryptedPrivateKey != update.EncryptedPrivateKey {
+		t.Errorf("keyWrap = %+v, encryptedPrivateKey = %q", user.KeyWrap, user.EncryptedPrivateKey)
+	}
+	if user.PublicKey != alice.PublicKey {
+		t.Error("a recifragem alterou a chave pública")
+	}
+}
@@ -0,0 +1,44 @@
+// server/services/conversation_service.go
+package services
+
+import (
+	"errors"
+
+	"server/config"
+	"server/models"
+)
+
+var (
+	ErrNotParticipant          = errors.New("usuário não participa da conversa")
+	ErrRecipientNotParticipant = errors.New("destinatário não participa da conversa")
+)
+
+// IsParticipant indica se o usuário faz parte da conversa
+func IsParticipant(conversationID, userID string) (bool, error) {
+	var count int64
+	err := config.DB.Model(&models.ConversationParticipant{}).
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// RequireParticipant retorna ErrNotParticipant quando o usuário não faz parte da conversa
+func RequireParticipant(conversationID, userID string) error {
+	ok, err := IsParticipant(conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotParticipant
+	}
+	return nil
+}
+
+// ParticipantIDs retorna os IDs dos usuários que participam da conversa
+func ParticipantIDs(conversationID string) ([]string, error) {
+	var participants []models.ConversationParticipant
+	if err := config.DB.Where("conversation_id = ?", conversationID).Find(&participants).Error; err != nil {
+		return nil, err
+	}
+	return models.ConversationParticipants(participants).GetUserIDs(), nil
+}
@@ -0,0 +1,161 @@
+// server/services/disappearing_service.go
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"server/config"
+	"server/models"
+	"server/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxDisappearingTimer é o maior temporizador aceito para mensagens temporárias
+	MaxDisappearingTimer = 4 * 7 * 24 * time.Hour
+	// MessageSweepInterval é o intervalo entre as remoções de mensagens expiradas
+	MessageSweepInterval = time.Minute
+
+	messageSweepBatchSize = 500
+)
+
+var ErrInvalidTimer = errors.New("temporizador inválido")
+
+// SetDisappearingTimer altera o temporizador da conversa e registra a alteração como
+// mensagem de sistema, visível a todos os participantes. Mensagens já enviadas mantêm
+// a expiração calculada no envio.
+func SetDisappearingTimer(conversationID, actorID string, seconds int64) (*models.Message, error) {
+	if seconds < 0 || time.Duration(seconds)*time.Second > MaxDisappearingTimer {
+		return nil, ErrInvalidTimer
+	}
+
+	participantIDs, err := ParticipantIDs(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(participantIDs, actorID) {
+		return nil, ErrNotParticipant
+	}
+
+	// Quem não pode enviar mensagens também não altera o temporizador
+	if err := CanPost(conversationID, actorID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	message := models.Message{
+		ID:             utils.GenerateUUID(),
+		ConversationID: conversationID,
+		SenderID:       actorID,
+		Type:           models.MessageTypeSystem,
+		System: &models.SystemEvent{
+			Event:               models.SystemEventTimerChanged,
+			ActorID:             actorID,
+			DisappearingSeconds: seconds,
+		},
+		CreatedAt: now,
+	}
+
+	recipients := make([]models.MessageRecipient, 0, len(participantIDs))
+	for _, participantID := range participantIDs {
+		recipients = append(recipients, models.MessageRecipient{
+			ID:              utils.GenerateUUID(),
+			MessageID:       message.ID,
+			RecipientID:     participantID,
+			Status:          models.StatusSent,
+			StatusUpdatedAt: now,
+		})
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Conversation{}).
+			Where("id = ?", conversationID).
+			Update("disappearing_seconds", seconds).Error; err != nil {
+			return err
+		}
+		return createMessageRows(tx, &message, recipients)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	message.Recipients = recipients
+	return &message, nil
+}
+
+// SweepExpiredMessages remove definitivamente as mensagens expiradas e seus destinatários.
+// Retorna os IDs removidos agrupados por conversa.
+func SweepExpiredMessages(now time.Time) (map[string][]string, error) {
+	var messages []models.Message
+	if err := config.DB.Select("id", "conversation_id").
+		Where("expires_at IS NOT NULL AND expires_at <= ?", now).
+		Limit(messageSweepBatchSize).
+		Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(messages))
+	expired := make(map[string][]string)
+	for i, m := range messages {
+		ids[i] = m.ID
+		expired[m.ConversationID] = append(expired[m.ConversationID], m.ID)
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("message_id IN ?", ids).Delete(&models.MessageRecipient{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&models.Message{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return expired, nil
+}
+
+// StartMessageSweeper remove periodicamente as mensagens expiradas e chama onExpired
+// para cada conversa afetada, permitindo avisar os clientes
+func StartMessageSweeper(interval time.Duration, onExpired func(conversationID string, messageIDs []string)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			for {
+				expired, err := SweepExpiredMessages(time.Now())
+				if err != nil {
+					log.Printf("Erro ao remover mensagens expiradas: %v", err)
+					break
+				}
+
+				removed := 0
+				for conversationID, messageIDs := range expired {
+					removed += len(messageIDs)
+					onExpired(conversationID, messageIDs)
+				}
+
+				// Continuar enquanto houver lotes completos pendentes
+				if removed < messageSweepBatchSize {
+					break
+				}
+			}
+		}
+	}()
+}
+
+// expiryFor calcula a expiração de uma mensagem enviada em createdAt na conversa
+func expiryFor(conversation models.Conversation, createdAt time.Time) *time.Time {
+	if conversation.DisappearingSeconds <= 0 {
+		return nil
+	}
+	expiresAt := createdAt.Add(time.Duration(conversation.DisappearingSeconds) * time.Second)
+	return &expiresAt
+}
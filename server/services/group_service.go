@@ -0,0 +1,520 @@
+// server/services/group_service.go
+package services
+
+import (
+	"errors"
+	"time"
+
+	"server/config"
+	"server/models"
+	"server/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrGroupNotFound     = errors.New("grupo não encontrado")
+	ErrNotGroupAdmin     = errors.New("apenas administradores podem alterar o grupo")
+	ErrNotGroupOwner     = errors.New("apenas o dono pode realizar esta ação")
+	ErrContactsNotFound  = errors.New("um ou mais contatos não foram encontrados")
+	ErrAlreadyMember     = errors.New("usuário já participa do grupo")
+	ErrNotMember         = errors.New("usuário não participa do grupo")
+	ErrCannotRemoveOwner = errors.New("o dono não pode ser removido do grupo")
+	ErrCannotRemoveAdmin = errors.New("apenas o dono pode remover administradores")
+	ErrInvalidRoleChange = errors.New("alteração de papel inválida")
+	ErrPostingRestricted = errors.New("apenas administradores podem enviar mensagens neste grupo")
+	ErrStaleEpoch        = errors.New("a época do grupo mudou; atualize a lista de membros")
+)
+
+// Motivos registrados no histórico de épocas
+const (
+	EpochReasonCreated        = "created"
+	EpochReasonMembersAdded   = "members_added"
+	EpochReasonMembersRemoved = "members_removed"
+	EpochReasonMemberLeft     = "member_left"
+)
+
+// GroupChange descreve o resultado de uma alteração no grupo para notificação dos membros
+type GroupChange struct {
+	Group     models.Group
+	UserIDs   []string // Usuários afetados pela alteração
+	MemberIDs []string // Membros após a alteração
+	NotifyIDs []string // Membros atuais e removidos, que devem ser notificados
+}
+
+// GroupSettings contém as configurações alteráveis do grupo; campos nil não são alterados
+type GroupSettings struct {
+	Name                    *string
+	OnlyAdminsCanPost       *bool
+	OnlyAdminsCanAddMembers *bool
+	SenderKeyMode           *bool
+}
+
+// groupState reúne o grupo e seus participantes, ordenados por data de entrada
+type groupState struct {
+	group        *models.Group
+	participants []models.ConversationParticipant
+}
+
+// FindGroup busca o grupo pelo ID da conversa
+func FindGroup(tx *gorm.DB, conversationID string) (*models.Group, error) {
+	var group models.Group
+	if err := tx.First(&group, "conversation_id = ?", conversationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGroupNotFound
+		}
+		return nil, err
+	}
+	return &group, nil
+}
+
+// ResolveContactUserIDs converte IDs de contatos do usuário nos IDs dos usuários correspondentes
+func ResolveContactUserIDs(userID string, contactIDs []string) ([]string, error) {
+	var contacts []models.Contact
+	if err := config.DB.Where("user_id = ? AND id IN ?", userID, contactIDs).Find(&contacts).Error; err != nil {
+		return nil, err
+	}
+
+	if len(contacts) != len(contactIDs) {
+		return nil, ErrContactsNotFound
+	}
+
+	ids := make([]string, len(contacts))
+	for i, contact := range contacts {
+		ids[i] = contact.ContactID
+	}
+	return ids, nil
+}
+
+// CanPost verifica se o usuário pode enviar mensagens para a conversa.
+// Conversas diretas e grupos sem restrição aceitam qualquer participante.
+func CanPost(conversationID, userID string) error {
+	var group models.Group
+	err := config.DB.First(&group, "conversation_id = ?", conversationID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !group.OnlyAdminsCanPost {
+		return nil
+	}
+
+	var participant models.ConversationParticipant
+	if err := config.DB.Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		First(&participant).Error; err != nil {
+		return ErrNotParticipant
+	}
+
+	if !participant.IsAdmin() {
+		return ErrPostingRestricted
+	}
+	return nil
+}
+
+// AddGroupMembers adiciona usuários ao grupo. Quando o grupo restringe a entrada,
+// somente administradores podem adicionar membros.
+func AddGroupMembers(conversationID, actorID string, userIDs []string) (*GroupChange, error) {
+	var change *GroupChange
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		state, err := loadGroupState(tx, conversationID)
+		if err != nil {
+			return err
+		}
+
+		// Quem não participa do grupo não pode adicionar ninguém; ErrNotMember fica para os alvos
+		actor, ok := state.participant(actorID)
+		if !ok {
+			return ErrNotParticipant
+		}
+		if state.group.OnlyAdminsCanAddMembers && !actor.IsAdmin() {
+			return ErrNotGroupAdmin
+		}
+
+		memberIDs := state.memberIDs()
+		for _, id := range userIDs {
+			if containsString(memberIDs, id) {
+				return ErrAlreadyMember
+			}
+
+			participant := models.ConversationParticipant{
+				ID:             utils.GenerateUUID(),
+				ConversationID: conversationID,
+				UserID:         id,
+				Role:           models.RoleMember,
+				JoinedAt:       time.Now(),
+			}
+			if err := tx.Create(&participant).Error; err != nil {
+				return err
+			}
+			memberIDs = append(memberIDs, id)
+		}
+
+		if err := BumpGroupEpoch(tx, state.group, memberIDs, EpochReasonMembersAdded, actorID); err != nil {
+			return err
+		}
+
+		change = &GroupChange{Group: *state.group, UserIDs: userIDs, MemberIDs: memberIDs, NotifyIDs: memberIDs}
+		return nil
+	})
+	return change, err
+}
+
+// RemoveGroupMembers remove usuários do grupo. Administradores removem membros;
+// somente o dono remove outros administradores e ninguém remove o dono.
+func RemoveGroupMembers(conversationID, actorID string, userIDs []string) (*GroupChange, error) {
+	var change *GroupChange
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		state, err := loadGroupState(tx, conversationID)
+		if err != nil {
+			return err
+		}
+
+		actor, err := state.requireAdmin(actorID)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range userIDs {
+			target, ok := state.participant(id)
+			if !ok {
+				return ErrNotMember
+			}
+			if target.Role == models.RoleOwner {
+				return ErrCannotRemoveOwner
+			}
+			if target.Role == models.RoleAdmin && actor.Role != models.RoleOwner {
+				return ErrCannotRemoveAdmin
+			}
+		}
+
+		if err := tx.Where("conversation_id = ? AND user_id IN ?", conversationID, userIDs).
+			Delete(&models.ConversationParticipant{}).Error; err != nil {
+			return err
+		}
+
+		memberIDs := state.memberIDs()
+		remaining := withoutStrings(memberIDs, userIDs)
+		if err := BumpGroupEpoch(tx, state.group, remaining, EpochReasonMembersRemoved, actorID); err != nil {
+			return err
+		}
+
+		change = &GroupChange{
+			Group:     *state.group,
+			UserIDs:   userIDs,
+			MemberIDs: remaining,
+			NotifyIDs: memberIDs,
+		}
+		return nil
+	})
+	return change, err
+}
+
+// LeaveGroup remove o próprio usuário do grupo. Se o dono sair, a posse passa para o
+// administrador mais antigo ou, na falta dele, para o membro mais antigo.
+func LeaveGroup(conversationID, userID string) (*GroupChange, error) {
+	var change *GroupChange
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		state, err := loadGroupState(tx, conversationID)
+		if err != nil {
+			return err
+		}
+
+		leaving, ok := state.participant(userID)
+		if !ok {
+			return ErrNotMember
+		}
+
+		if err := tx.Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+			Delete(&models.ConversationParticipant{}).Error; err != nil {
+			return err
+		}
+
+		memberIDs := state.memberIDs()
+		remaining := withoutStrings(memberIDs, []string{userID})
+		affected := []string{userID}
+
+		if leaving.Role == models.RoleOwner && len(remaining) > 0 {
+			successor := state.successor(userID)
+			if err := transferOwnership(tx, state.group, successor.UserID); err != nil {
+				return err
+			}
+			affected = append(affected, successor.UserID)
+		}
+
+		if err := BumpGroupEpoch(tx, state.group, remaining, EpochReasonMemberLeft, userID); err != nil {
+			return err
+		}
+
+		change = &GroupChange{Group: *state.group, UserIDs: affected, MemberIDs: remaining, NotifyIDs: memberIDs}
+		return nil
+	})
+	return change, err
+}
+
+// UpdateGroupSettings altera o nome e as configurações do grupo; somente administradores podem fazê-lo
+func UpdateGroupSettings(conversationID, actorID string, settings GroupSettings) (*GroupChange, error) {
+	var change *GroupChange
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		state, err := loadGroupState(tx, conversationID)
+		if err != nil {
+			return err
+		}
+
+		if _, err := state.requireAdmin(actorID); err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{}
+		if settings.Name != nil {
+			state.group.Name = *settings.Name
+			updates["name"] = *settings.Name
+		}
+		if settings.OnlyAdminsCanPost != nil {
+			state.group.OnlyAdminsCanPost = *settings.OnlyAdminsCanPost
+			updates["only_admins_can_post"] = *settings.OnlyAdminsCanPost
+		}
+		if settings.OnlyAdminsCanAddMembers != nil {
+			state.group.OnlyAdminsCanAddMembers = *settings.OnlyAdminsCanAddMembers
+			updates["only_admins_can_add_members"] = *settings.OnlyAdminsCanAddMembers
+		}
+		if settings.SenderKeyMode != nil {
+			state.group.SenderKeyMode = *settings.SenderKeyMode
+			updates["sender_key_mode"] = *settings.SenderKeyMode
+		}
+
+		if len(updates) > 0 {
+			if err := tx.Model(&models.Group{}).
+				Where("conversation_id = ?", conversationID).
+				Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		memberIDs := state.memberIDs()
+		change = &GroupChange{Group: *state.group, MemberIDs: memberIDs, NotifyIDs: memberIDs}
+		return nil
+	})
+	return change, err
+}
+
+// SetMemberRole promove um membro a administrador ou rebaixa um administrador.
+// Administradores podem promover; somente o dono pode rebaixar.
+func SetMemberRole(conversationID, actorID, targetID, role string) (*GroupChange, error) {
+	var change *GroupChange
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		state, err := loadGroupState(tx, conversationID)
+		if err != nil {
+			return err
+		}
+
+		actor, err := state.requireAdmin(actorID)
+		if err != nil {
+			return err
+		}
+
+		target, ok := state.participant(targetID)
+		if !ok {
+			return ErrNotMember
+		}
+
+		switch role {
+		case models.RoleAdmin:
+			if target.Role != models.RoleMember {
+				return ErrInvalidRoleChange
+			}
+		case models.RoleMember:
+			if actor.Role != models.RoleOwner {
+				return ErrNotGroupOwner
+			}
+			if target.Role != models.RoleAdmin {
+				return ErrInvalidRoleChange
+			}
+		default:
+			return ErrInvalidRoleChange
+		}
+
+		if err := setRole(tx, conversationID, targetID, role); err != nil {
+			return err
+		}
+
+		memberIDs := state.memberIDs()
+		change = &GroupChange{Group: *state.group, UserIDs: []string{targetID}, MemberIDs: memberIDs, NotifyIDs: memberIDs}
+		return nil
+	})
+	return change, err
+}
+
+// TransferGroupOwnership passa a posse do grupo para outro membro; o dono anterior vira administrador
+func TransferGroupOwnership(conversationID, actorID, targetID string) (*GroupChange, error) {
+	var change *GroupChange
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		state, err := loadGroupState(tx, conversationID)
+		if err != nil {
+			return err
+		}
+
+		actor, ok := state.participant(actorID)
+		if !ok || actor.Role != models.RoleOwner {
+			return ErrNotGroupOwner
+		}
+
+		if _, ok := state.participant(targetID); !ok || targetID == actorID {
+			return ErrNotMember
+		}
+
+		if err := setRole(tx, conversationID, actorID, models.RoleAdmin); err != nil {
+			return err
+		}
+		if err := transferOwnership(tx, state.group, targetID); err != nil {
+			return err
+		}
+
+		memberIDs := state.memberIDs()
+		change = &GroupChange{Group: *state.group, UserIDs: []string{actorID, targetID}, MemberIDs: memberIDs, NotifyIDs: memberIDs}
+		return nil
+	})
+	return change, err
+}
+
+// BumpGroupEpoch avança a época do grupo e registra a composição resultante.
+// Deve ser chamado na mesma transação que alterou os participantes.
+func BumpGroupEpoch(tx *gorm.DB, group *models.Group, memberIDs []string, reason, actorID string) error {
+	group.Epoch++
+	if err := tx.Model(&models.Group{}).
+		Where("conversation_id = ?", group.ConversationID).
+		Update("epoch", group.Epoch).Error; err != nil {
+		return err
+	}
+
+	return tx.Create(&models.GroupEpoch{
+		ID:             utils.GenerateUUID(),
+		ConversationID: group.ConversationID,
+		Epoch:          group.Epoch,
+		MemberIDs:      memberIDs,
+		Reason:         reason,
+		ActorID:        actorID,
+		CreatedAt:      time.Now(),
+	}).Error
+}
+
+// ListGroupEpochs retorna o histórico de épocas do grupo, da mais antiga para a mais recente
+func ListGroupEpochs(conversationID string) ([]models.GroupEpoch, error) {
+	if _, err := FindGroup(config.DB, conversationID); err != nil {
+		return nil, err
+	}
+
+	var epochs []models.GroupEpoch
+	err := config.DB.Where("conversation_id = ?", conversationID).
+		Order("epoch ASC").
+		Find(&epochs).Error
+	return epochs, err
+}
+
+// CurrentEpoch retorna a época atual da conversa (0 para conversas diretas) e,
+// se o cliente informou a época usada para cifrar, exige que seja a atual
+func CurrentEpoch(conversationID string, expected *int64) (int64, error) {
+	var group models.Group
+	err := config.DB.Select("conversation_id", "epoch").First(&group, "conversation_id = ?", conversationID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if expected != nil && *expected != group.Epoch {
+		return 0, ErrStaleEpoch
+	}
+	return group.Epoch, nil
+}
+
+// transferOwnership define o novo dono do grupo tanto no papel quanto em Group.AdminID
+func transferOwnership(tx *gorm.DB, group *models.Group, ownerID string) error {
+	if err := setRole(tx, group.ConversationID, ownerID, models.RoleOwner); err != nil {
+		return err
+	}
+
+	group.AdminID = ownerID
+	return tx.Model(&models.Group{}).
+		Where("conversation_id = ?", group.ConversationID).
+		Update("admin_id", ownerID).Error
+}
+
+// setRole altera o papel de um participante
+func setRole(tx *gorm.DB, conversationID, userID, role string) error {
+	return tx.Model(&models.ConversationParticipant{}).
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		Update("role", role).Error
+}
+
+// loadGroupState carrega o grupo e seus participantes em ordem de entrada
+func loadGroupState(tx *gorm.DB, conversationID string) (*groupState, error) {
+	group, err := FindGroup(tx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var participants []models.ConversationParticipant
+	if err := tx.Where("conversation_id = ?", conversationID).
+		Order("joined_at ASC").
+		Find(&participants).Error; err != nil {
+		return nil, err
+	}
+
+	return &groupState{group: group, participants: participants}, nil
+}
+
+// participant retorna o participante do grupo com o ID informado
+func (s *groupState) participant(userID string) (models.ConversationParticipant, bool) {
+	for _, p := range s.participants {
+		if p.UserID == userID {
+			return p, true
+		}
+	}
+	return models.ConversationParticipant{}, false
+}
+
+// requireAdmin retorna o participante se ele for dono ou administrador do grupo
+func (s *groupState) requireAdmin(userID string) (models.ConversationParticipant, error) {
+	p, ok := s.participant(userID)
+	if !ok || !p.IsAdmin() {
+		return p, ErrNotGroupAdmin
+	}
+	return p, nil
+}
+
+// successor escolhe o próximo dono: o administrador mais antigo ou o membro mais antigo
+func (s *groupState) successor(leavingID string) models.ConversationParticipant {
+	var oldest *models.ConversationParticipant
+	for i, p := range s.participants {
+		if p.UserID == leavingID {
+			continue
+		}
+		if p.Role == models.RoleAdmin {
+			return p
+		}
+		if oldest == nil {
+			oldest = &s.participants[i]
+		}
+	}
+	return *oldest
+}
+
+// memberIDs lista os IDs dos membros em ordem de entrada
+func (s *groupState) memberIDs() []string {
+	return models.ConversationParticipants(s.participants).GetUserIDs()
+}
+
+// withoutStrings retorna a lista sem os valores removidos
+func withoutStrings(list, removed []string) []string {
+	result := make([]string, 0, len(list))
+	for _, item := range list {
+		if !containsString(removed, item) {
+			result = append(result, item)
+		}
+	}
+	return result
+}
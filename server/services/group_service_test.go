@@ -0,0 +1,42 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"server/config"
+	"server/models"
+)
+
+func TestAddGroupMembersChecksActor(t *testing.T) {
+	setupTestDB(t)
+	owner := createTestUser(t, "dono")
+	member := createTestUser(t, "membro")
+	outsider := createTestUser(t, "estranho")
+	newcomer := createTestUser(t, "novato")
+	group := createTestGroup(t, owner.ID, member.ID)
+
+	// Quem está fora do grupo é recusado como ator, não como alvo
+	if _, err := AddGroupMembers(group.ConversationID, outsider.ID, []string{newcomer.ID}); !errors.Is(err, ErrNotParticipant) {
+		t.Errorf("ator de fora: erro = %v, esperado ErrNotParticipant", err)
+	}
+	if _, err := AddGroupMembers(group.ConversationID, member.ID, []string{owner.ID}); !errors.Is(err, ErrAlreadyMember) {
+		t.Errorf("alvo já membro: erro = %v, esperado ErrAlreadyMember", err)
+	}
+
+	if err := config.DB.Model(&models.Group{}).Where("conversation_id = ?", group.ConversationID).
+		Update("only_admins_can_add_members", true).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddGroupMembers(group.ConversationID, member.ID, []string{newcomer.ID}); !errors.Is(err, ErrNotGroupAdmin) {
+		t.Errorf("membro em grupo restrito: erro = %v, esperado ErrNotGroupAdmin", err)
+	}
+
+	change, err := AddGroupMembers(group.ConversationID, owner.ID, []string{newcomer.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(change.MemberIDs) != 3 || change.Group.Epoch != group.Epoch+1 {
+		t.Errorf("membros = %v, época = %d; esperado 3 membros e época %d", change.MemberIDs, change.Group.Epoch, group.Epoch+1)
+	}
+}
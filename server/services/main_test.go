@@ -0,0 +1,172 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"server/config"
+	"server/crypto/keywrap"
+	"server/models"
+	"server/utils"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestDB troca config.DB por um banco SQLite em memória, exclusivo do teste e com os
+// esquemas migrados. Uma única conexão serializa as transações como o arquivo em produção.
+func setupTestDB(t *testing.T) {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	if err := config.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := config.DB
+	config.DB = db
+	t.Cleanup(func() {
+		config.DB = previous
+		sqlDB.Close()
+	})
+}
+
+// testVector é o primeiro vetor ElGamal compartilhado com o cliente, usado como chave e
+// conteúdo cifrado válidos
+var testVector = sync.OnceValue(func() map[string]string {
+	raw, err := os.ReadFile("../crypto/elgamal/testdata/vectors.json")
+	if err != nil {
+		panic(err)
+	}
+	var file struct {
+		Vectors []map[string]string `json:"vectors"`
+	}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		panic(err)
+	}
+	return file.Vectors[0]
+})
+
+// testContent retorna um conteúdo cifrado aceito para a chave dos usuários de teste
+func testContent() models.ElGamalContent {
+	v := testVector()
+	return models.ElGamalContent{A: v["a"], B: v["b"], P: v["p"]}
+}
+
+// createTestUser grava um usuário com senha "senha", a chave de teste e parâmetros de chave atuais
+func createTestUser(t *testing.T, username string) models.User {
+	t.Helper()
+
+	hash, err := HashPassword("senha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{
+		ID:           utils.GenerateUUID(),
+		Username:     username,
+		PasswordHash: hash,
+		KeyWrap:      keywrap.Params{Version: keywrap.CurrentVersion},
+		PublicKey:    models.PublicKeyData{P: testVector()["p"], G: testVector()["g"], Y: testVector()["y"]},
+	}
+	if err := config.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// createTestConversation grava uma conversa direta entre os usuários
+func createTestConversation(t *testing.T, userIDs ...string) string {
+	t.Helper()
+
+	conversation := models.Conversation{ID: utils.GenerateUUID(), Type: "DIRECT", CreatedAt: time.Now()}
+	if err := config.DB.Create(&conversation).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, userID := range userIDs {
+		participant := models.ConversationParticipant{
+			ID:             utils.GenerateUUID(),
+			ConversationID: conversation.ID,
+			UserID:         userID,
+			Role:           models.RoleMember,
+			JoinedAt:       time.Now(),
+		}
+		if err := config.DB.Create(&participant).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return conversation.ID
+}
+
+// createTestGroup grava um grupo do dono com os membros e registra a época inicial
+func createTestGroup(t *testing.T, ownerID string, memberIDs ...string) *models.Group {
+	t.Helper()
+
+	conversation := models.Conversation{ID: utils.GenerateUUID(), Type: "GROUP", CreatedAt: time.Now()}
+	group := models.Group{ConversationID: conversation.ID, Name: "grupo", AdminID: ownerID, CreatedAt: time.Now()}
+	allIDs := append([]string{ownerID}, memberIDs...)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&conversation).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		for _, userID := range allIDs {
+			role := models.RoleMember
+			if userID == ownerID {
+				role = models.RoleOwner
+			}
+			participant := models.ConversationParticipant{
+				ID:             utils.GenerateUUID(),
+				ConversationID: conversation.ID,
+				UserID:         userID,
+				Role:           role,
+				JoinedAt:       time.Now(),
+			}
+			if err := tx.Create(&participant).Error; err != nil {
+				return err
+			}
+		}
+		return BumpGroupEpoch(tx, &group, allIDs, EpochReasonCreated, ownerID)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &group
+}
+
+// sendTestMessage envia uma mensagem cifrada para cada destinatário
+func sendTestMessage(t *testing.T, conversationID, senderID string, recipientIDs ...string) *models.Message {
+	t.Helper()
+
+	contents := make(map[string]models.ElGamalContent, len(recipientIDs))
+	for _, id := range recipientIDs {
+		contents[id] = testContent()
+	}
+	message, _, err := CreateMessage(NewMessageInput{
+		ConversationID:    conversationID,
+		SenderID:          senderID,
+		EncryptedContents: contents,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
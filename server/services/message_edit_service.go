@@ -0,0 +1,296 @@
+// server/services/message_edit_service.go
+package services
+
+import (
+	"errors"
+	"time"
+
+	"server/config"
+	"server/crypto/elgamal"
+	"server/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrMessageNotFound    = errors.New("mensagem não encontrada")
+	ErrNotMessageSender   = errors.New("apenas o remetente pode alterar a mensagem")
+	ErrMessageDeleted     = errors.New("a mensagem foi apagada")
+	ErrRecipientsMismatch = errors.New("a edição deve substituir o conteúdo de todos os destinatários originais")
+)
+
+// EditMessageInput reúne os novos conteúdos cifrados de uma mensagem já enviada
+type EditMessageInput struct {
+	ConversationID          string
+	MessageID               string
+	SenderID                string
+	EncryptedContents       map[string]models.ElGamalContent // userID -> conteúdo
+	DeviceEncryptedContents map[string]models.ElGamalContent // deviceID -> conteúdo
+	SenderKeyContent        *models.SenderKeyContent
+}
+
+// EditMessage substitui os conteúdos cifrados da mensagem. A versão do formato é a do
+// envio original e os destinatários são os originais que ainda participam da conversa:
+// quem saiu depois do envio mantém o conteúdo anterior e não recebe o novo.
+func EditMessage(input EditMessageInput) (*models.Message, error) {
+	message, err := findOwnMessage(input.ConversationID, input.MessageID, input.SenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	participantIDs, err := ParticipantIDs(message.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(participantIDs, input.SenderID) {
+		return nil, ErrNotParticipant
+	}
+
+	if message.SenderKeyContent != nil {
+		return editSenderKeyMessage(message, input)
+	}
+	if input.SenderKeyContent != nil {
+		return nil, ErrMixedVersions
+	}
+
+	if err := validateUserContents(input.EncryptedContents, "encryptedContents"); err != nil {
+		return nil, err
+	}
+	if err := validateDeviceContents(input.DeviceEncryptedContents, participantIDs); err != nil {
+		return nil, err
+	}
+
+	// Cada destinatário original ainda presente deve receber um novo conteúdo, e nenhum outro
+	targets, err := currentRecipients(message, participantIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(input.EncryptedContents)+len(input.DeviceEncryptedContents) != len(targets) {
+		return nil, ErrRecipientsMismatch
+	}
+	for _, r := range targets {
+		var ok bool
+		if r.DeviceID == "" {
+			_, ok = input.EncryptedContents[r.RecipientID]
+		} else {
+			_, ok = input.DeviceEncryptedContents[r.DeviceID]
+		}
+		if !ok {
+			return nil, ErrRecipientsMismatch
+		}
+	}
+
+	version, err := contentsVersion(NewMessageInput{
+		EncryptedContents:       input.EncryptedContents,
+		DeviceEncryptedContents: input.DeviceEncryptedContents,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if version != message.Version {
+		return nil, ErrMixedVersions
+	}
+
+	now := time.Now()
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		for _, r := range targets {
+			if r.DeviceID == "" {
+				r.EncryptedContent = input.EncryptedContents[r.RecipientID]
+			} else {
+				r.EncryptedContent = input.DeviceEncryptedContents[r.DeviceID]
+			}
+			if err := tx.Model(r).Update("encrypted_content", r.EncryptedContent).Error; err != nil {
+				return err
+			}
+		}
+		changeSeq, err := nextChangeSeq(tx, message.ConversationID)
+		if err != nil {
+			return err
+		}
+		message.ChangeSeq = changeSeq
+		return tx.Model(message).Updates(map[string]interface{}{
+			"edited_at":  now,
+			"change_seq": changeSeq,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	message.EditedAt = &now
+	return message, nil
+}
+
+// DeleteMessage apaga a mensagem para todos, mantendo um registro sem conteúdo
+func DeleteMessage(conversationID, messageID, senderID string) (*models.Message, error) {
+	message, err := findOwnMessage(conversationID, messageID, senderID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.MessageRecipient{}).
+			Where("message_id = ?", message.ID).
+			Update("encrypted_content", models.ElGamalContent{}).Error; err != nil {
+			return err
+		}
+		changeSeq, err := nextChangeSeq(tx, message.ConversationID)
+		if err != nil {
+			return err
+		}
+		message.ChangeSeq = changeSeq
+		return tx.Model(message).Updates(map[string]interface{}{
+			"deleted_at":         now,
+			"sender_key_content": nil,
+			"change_seq":         changeSeq,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	message.DeletedAt = &now
+	message.SenderKeyContent = nil
+	for i := range message.Recipients {
+		message.Recipients[i].EncryptedContent = models.ElGamalContent{}
+	}
+	return message, nil
+}
+
+// currentRecipients retorna os destinatários originais da mensagem que ainda participam da
+// conversa, sem os dispositivos revogados depois do envio
+func currentRecipients(message *models.Message, participantIDs []string) ([]*models.MessageRecipient, error) {
+	deviceIDs := make([]string, 0, len(message.Recipients))
+	for _, r := range message.Recipients {
+		if r.DeviceID != "" {
+			deviceIDs = append(deviceIDs, r.DeviceID)
+		}
+	}
+
+	var activeIDs []string
+	if len(deviceIDs) > 0 {
+		if err := config.DB.Model(&models.Device{}).
+			Where("id IN ? AND revoked_at IS NULL", deviceIDs).
+			Pluck("id", &activeIDs).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]*models.MessageRecipient, 0, len(message.Recipients))
+	for i, r := range message.Recipients {
+		if !containsString(participantIDs, r.RecipientID) {
+			continue
+		}
+		if r.DeviceID != "" && !containsString(activeIDs, r.DeviceID) {
+			continue
+		}
+		result = append(result, &message.Recipients[i])
+	}
+	return result, nil
+}
+
+// findOwnMessage carrega a mensagem da conversa com seus destinatários, exigindo que o
+// usuário seja o remetente e que a mensagem não tenha sido apagada
+func findOwnMessage(conversationID, messageID, senderID string) (*models.Message, error) {
+	var message models.Message
+	err := config.DB.Preload("Recipients").
+		Where("id = ? AND conversation_id = ?", messageID, conversationID).
+		First(&message).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if message.SenderID != senderID {
+		return nil, ErrNotMessageSender
+	}
+	if message.DeletedAt != nil {
+		return nil, ErrMessageDeleted
+	}
+	return &message, nil
+}
+
+// editSenderKeyMessage troca o corpo de uma mensagem cifrada com chave de remetente.
+// A nova chave deve ter sido distribuída na mesma época da mensagem original, e a edição
+// é recusada quando a época mudou, pois quem saiu do grupo ainda tem as chaves dela.
+func editSenderKeyMessage(message *models.Message, input EditMessageInput) (*models.Message, error) {
+	if input.SenderKeyContent == nil || len(input.EncryptedContents) > 0 || len(input.DeviceEncryptedContents) > 0 {
+		return nil, ErrMixedVersions
+	}
+	if _, err := CurrentEpoch(message.ConversationID, &message.Epoch); err != nil {
+		return nil, err
+	}
+
+	content := input.SenderKeyContent
+	if err := elgamal.ValidateSenderKeyContent(content.KeyID, content.Nonce, content.CT); err != nil {
+		return nil, prefixValidationError(err, "senderKeyContent")
+	}
+
+	recipientIDs := make([]string, 0, len(message.Recipients))
+	for _, r := range message.Recipients {
+		recipientIDs = append(recipientIDs, r.RecipientID)
+	}
+	if err := requireSenderKey(message.ConversationID, message.SenderID, content.KeyID, message.Epoch, recipientIDs); err != nil {
+		return nil, err
+	}
+
+	// Atualização por struct para que o serializer JSON do conteúdo seja aplicado
+	now := time.Now()
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		changeSeq, err := nextChangeSeq(tx, message.ConversationID)
+		if err != nil {
+			return err
+		}
+		message.SenderKeyContent = content
+		message.EditedAt = &now
+		message.ChangeSeq = changeSeq
+		return tx.Model(message).Select("sender_key_content", "edited_at", "change_seq").Updates(message).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// nextChangeSeq reserva a próxima posição de alteração da conversa, registrada na mensagem
+// editada ou apagada para que o reenvio a encontre. Deve ser chamado na mesma transação.
+func nextChangeSeq(tx *gorm.DB, conversationID string) (int64, error) {
+	result := tx.Model(&models.Conversation{}).
+		Where("id = ?", conversationID).
+		UpdateColumn("last_change_seq", gorm.Expr("last_change_seq + 1"))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	var conversation models.Conversation
+	if err := tx.Select("last_change_seq").First(&conversation, "id = ?", conversationID).Error; err != nil {
+		return 0, err
+	}
+	return conversation.LastChangeSeq, nil
+}
+
+// validateDeviceContents confere conteúdos indexados por dispositivo com as chaves registradas,
+// recusando dispositivos revogados e os de quem não participa da conversa
+func validateDeviceContents(contents map[string]models.ElGamalContent, participantIDs []string) error {
+	devices, err := findActiveDevices(contents)
+	if err != nil {
+		return err
+	}
+
+	for id, d := range devices {
+		if !containsString(participantIDs, d.UserID) {
+			return ErrRecipientNotParticipant
+		}
+		if err := validateContent(contents[id], d.PublicKey); err != nil {
+			return prefixValidationError(err, "deviceEncryptedContents."+id)
+		}
+	}
+	return nil
+}
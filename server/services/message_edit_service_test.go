@@ -0,0 +1,225 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"server/config"
+	"server/crypto/elgamal"
+	"server/models"
+)
+
+// editedContent cifra um texto novo com a chave de teste, distinguível do conteúdo original
+func editedContent(t *testing.T) models.ElGamalContent {
+	t.Helper()
+
+	v := testVector()
+	pub, err := elgamal.ParsePublicKey(v["p"], v["g"], v["y"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := elgamal.Encrypt(rand.Reader, pub, "editada")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return models.ElGamalContent{A: c.A.String(), B: c.B.String(), P: c.P.String()}
+}
+
+// recipientContents carrega o conteúdo gravado para cada destinatário da mensagem
+func recipientContents(t *testing.T, messageID string) map[string]models.ElGamalContent {
+	t.Helper()
+
+	var recipients []models.MessageRecipient
+	if err := config.DB.Where("message_id = ?", messageID).Find(&recipients).Error; err != nil {
+		t.Fatal(err)
+	}
+	result := make(map[string]models.ElGamalContent, len(recipients))
+	for _, r := range recipients {
+		result[r.RecipientID] = r.EncryptedContent
+	}
+	return result
+}
+
+func TestEditMessageSkipsMembersWhoLeft(t *testing.T) {
+	setupTestDB(t)
+	owner := createTestUser(t, "dono")
+	member := createTestUser(t, "membro")
+	leaver := createTestUser(t, "ex-membro")
+	group := createTestGroup(t, owner.ID, member.ID, leaver.ID)
+
+	message := sendTestMessage(t, group.ConversationID, owner.ID, owner.ID, member.ID, leaver.ID)
+	if _, err := LeaveGroup(group.ConversationID, leaver.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	content := editedContent(t)
+	input := EditMessageInput{
+		ConversationID: group.ConversationID,
+		MessageID:      message.ID,
+		SenderID:       owner.ID,
+		EncryptedContents: map[string]models.ElGamalContent{
+			owner.ID: content, member.ID: content, leaver.ID: content,
+		},
+	}
+
+	// Quem saiu não pode receber o novo conteúdo
+	if _, err := EditMessage(input); !errors.Is(err, ErrRecipientsMismatch) {
+		t.Fatalf("edição para quem saiu: erro = %v, esperado ErrRecipientsMismatch", err)
+	}
+
+	delete(input.EncryptedContents, leaver.ID)
+	edited, err := EditMessage(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited.EditedAt == nil || edited.ChangeSeq == 0 {
+		t.Errorf("editedAt = %v, changeSeq = %d", edited.EditedAt, edited.ChangeSeq)
+	}
+
+	stored := recipientContents(t, message.ID)
+	if stored[owner.ID] != content || stored[member.ID] != content {
+		t.Error("participantes atuais não receberam o novo conteúdo")
+	}
+	if stored[leaver.ID] != testContent() {
+		t.Error("o conteúdo de quem saiu do grupo foi alterado")
+	}
+
+	// Quem saiu também não pode editar as próprias mensagens
+	own := sendTestMessage(t, group.ConversationID, member.ID, owner.ID, member.ID)
+	if _, err := LeaveGroup(group.ConversationID, member.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = EditMessage(EditMessageInput{
+		ConversationID:    group.ConversationID,
+		MessageID:         own.ID,
+		SenderID:          member.ID,
+		EncryptedContents: map[string]models.ElGamalContent{owner.ID: content},
+	})
+	if !errors.Is(err, ErrNotParticipant) {
+		t.Errorf("remetente fora do grupo: erro = %v, esperado ErrNotParticipant", err)
+	}
+}
+
+func TestEditSenderKeyMessageRefusesPastEpoch(t *testing.T) {
+	setupTestDB(t)
+	owner := createTestUser(t, "dono")
+	member := createTestUser(t, "membro")
+	leaver := createTestUser(t, "ex-membro")
+	group := createTestGroup(t, owner.ID, member.ID, leaver.ID)
+
+	message := models.Message{
+		ID:               "mensagem-sk",
+		ConversationID:   group.ConversationID,
+		SenderID:         owner.ID,
+		Type:             models.MessageTypeUser,
+		Version:          elgamal.VersionSenderKey,
+		Epoch:            group.Epoch,
+		SenderKeyContent: &models.SenderKeyContent{KeyID: "k1"},
+	}
+	if _, err := saveMessage(message, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LeaveGroup(group.ConversationID, leaver.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Quem saiu ainda tem as chaves de remetente da época da mensagem
+	_, err := EditMessage(EditMessageInput{
+		ConversationID:   group.ConversationID,
+		MessageID:        message.ID,
+		SenderID:         owner.ID,
+		SenderKeyContent: &models.SenderKeyContent{KeyID: "k1"},
+	})
+	if !errors.Is(err, ErrStaleEpoch) {
+		t.Errorf("erro = %v, esperado ErrStaleEpoch", err)
+	}
+}
+
+// createTestDevice grava um dispositivo do usuário com a chave de teste
+func createTestDevice(t *testing.T, userID, id string) {
+	t.Helper()
+
+	v := testVector()
+	device := models.Device{
+		ID:        id,
+		UserID:    userID,
+		Name:      id,
+		PublicKey: models.PublicKeyData{P: v["p"], G: v["g"], Y: v["y"]},
+		CreatedAt: time.Now(),
+	}
+	if err := config.DB.Create(&device).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEditMessageChecksDevices(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	mallory := createTestUser(t, "mallory")
+	conversation := createTestConversation(t, alice.ID, bob.ID)
+	createTestDevice(t, bob.ID, "celular")
+	createTestDevice(t, bob.ID, "notebook")
+	createTestDevice(t, mallory.ID, "intruso")
+
+	message, _, err := CreateMessage(NewMessageInput{
+		ConversationID:          conversation,
+		SenderID:                alice.ID,
+		EncryptedContents:       map[string]models.ElGamalContent{alice.ID: testContent()},
+		DeviceEncryptedContents: map[string]models.ElGamalContent{"celular": testContent(), "notebook": testContent()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := config.DB.Model(&models.Device{}).Where("id = ?", "notebook").Update("revoked_at", &now).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	content := editedContent(t)
+	edit := func(devices ...string) error {
+		contents := make(map[string]models.ElGamalContent, len(devices))
+		for _, id := range devices {
+			contents[id] = content
+		}
+		_, err := EditMessage(EditMessageInput{
+			ConversationID:          conversation,
+			MessageID:               message.ID,
+			SenderID:                alice.ID,
+			EncryptedContents:       map[string]models.ElGamalContent{alice.ID: content},
+			DeviceEncryptedContents: contents,
+		})
+		return err
+	}
+
+	tests := []struct {
+		name    string
+		devices []string
+		err     error
+	}{
+		{"dispositivo revogado", []string{"celular", "notebook"}, ErrDeviceRevoked},
+		{"dispositivo de terceiro", []string{"celular", "intruso"}, ErrRecipientNotParticipant},
+		{"dispositivo desconhecido", []string{"celular", "outro"}, ErrDeviceNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := edit(tt.devices...); !errors.Is(err, tt.err) {
+				t.Errorf("erro = %v, esperado %v", err, tt.err)
+			}
+		})
+	}
+
+	// O dispositivo revogado depois do envio deixa de ser exigido e mantém o conteúdo antigo
+	if err := edit("celular"); err != nil {
+		t.Fatal(err)
+	}
+	var revoked models.MessageRecipient
+	if err := config.DB.Where("message_id = ? AND device_id = ?", message.ID, "notebook").First(&revoked).Error; err != nil {
+		t.Fatal(err)
+	}
+	if revoked.EncryptedContent != testContent() {
+		t.Error("o conteúdo do dispositivo revogado foi alterado")
+	}
+}
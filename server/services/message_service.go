@@ -0,0 +1,642 @@
+// server/services/message_service.go
+package services
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/config"
+	"server/crypto/elgamal"
+	"server/models"
+	"server/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmptyMessage      = errors.New("nenhum conteúdo criptografado informado")
+	ErrDeviceNotFound    = errors.New("dispositivo não encontrado")
+	ErrDeviceRevoked     = errors.New("dispositivo revogado")
+	ErrRecipientNotFound = errors.New("destinatário não encontrado")
+	ErrMixedVersions     = errors.New("todos os conteúdos de uma mensagem devem usar a mesma versão")
+	ErrInvalidClientID   = errors.New("clientMessageId deve ter no máximo 64 caracteres")
+	ErrClientIDConflict  = errors.New("clientMessageId já usado em outra conversa")
+)
+
+// MaxClientMessageIDLength limita o tamanho da chave de idempotência enviada pelo cliente
+const MaxClientMessageIDLength = 64
+
+// NewMessageInput reúne os dados de uma nova mensagem enviada por REST ou WebSocket
+type NewMessageInput struct {
+	ConversationID          string
+	SenderID                string
+	EncryptedContents       map[string]models.ElGamalContent // userID -> conteúdo
+	DeviceEncryptedContents map[string]models.ElGamalContent // deviceID -> conteúdo
+	Epoch                   *int64                           // Época do grupo usada pelo cliente, se informada
+	SenderKeyContent        *models.SenderKeyContent         // Corpo único cifrado com a chave de remetente
+	ClientMessageID         string                           // Chave de idempotência opcional, única por remetente
+}
+
+// CreateMessage salva a mensagem e um MessageRecipient para cada usuário e dispositivo destinatário.
+// No modo de chave de remetente o conteúdo é salvo uma única vez na própria mensagem.
+// Se o remetente já enviou uma mensagem com o mesmo ClientMessageID, ela é retornada
+// sem criar outra e o segundo retorno é verdadeiro.
+func CreateMessage(input NewMessageInput) (*models.Message, bool, error) {
+	if input.ClientMessageID == "" {
+		message, err := createMessage(input)
+		return message, false, err
+	}
+
+	if len(input.ClientMessageID) > MaxClientMessageIDLength {
+		return nil, false, ErrInvalidClientID
+	}
+
+	if existing, err := findByClientMessageID(input); err != nil || existing != nil {
+		return existing, existing != nil, err
+	}
+
+	message, err := createMessage(input)
+	if err != nil {
+		// Uma tentativa concorrente pode ter gravado a mesma chave primeiro
+		existing, findErr := findByClientMessageID(input)
+		if errors.Is(findErr, ErrClientIDConflict) {
+			return nil, false, findErr
+		}
+		if findErr == nil && existing != nil {
+			return existing, true, nil
+		}
+		return nil, false, err
+	}
+	return message, false, nil
+}
+
+// findByClientMessageID busca a mensagem do remetente com a chave de idempotência. A chave
+// já usada em outra conversa resulta em ErrClientIDConflict.
+func findByClientMessageID(input NewMessageInput) (*models.Message, error) {
+	var messages []models.Message
+	// Apenas os conteúdos do próprio remetente são necessários para responder à nova tentativa
+	if err := config.DB.Preload("Recipients", "recipient_id = ?", input.SenderID).
+		Where("sender_id = ? AND client_message_id = ?", input.SenderID, input.ClientMessageID).
+		Limit(1).
+		Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+	if messages[0].ConversationID != input.ConversationID {
+		return nil, ErrClientIDConflict
+	}
+	return &messages[0], nil
+}
+
+// createMessage valida e grava uma nova mensagem
+func createMessage(input NewMessageInput) (*models.Message, error) {
+	if len(input.EncryptedContents) == 0 && len(input.DeviceEncryptedContents) == 0 && input.SenderKeyContent == nil {
+		return nil, ErrEmptyMessage
+	}
+
+	// Somente participantes podem enviar mensagens para a conversa
+	participantIDs, err := ParticipantIDs(input.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(participantIDs, input.SenderID) {
+		return nil, ErrNotParticipant
+	}
+
+	// Grupos podem restringir o envio aos administradores
+	if err := CanPost(input.ConversationID, input.SenderID); err != nil {
+		return nil, err
+	}
+
+	// Conteúdos cifrados para uma composição anterior do grupo são recusados
+	epoch, err := CurrentEpoch(input.ConversationID, input.Epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.SenderKeyContent != nil {
+		return createSenderKeyMessage(input, participantIDs, epoch)
+	}
+
+	// Resolver os donos dos dispositivos e recusar dispositivos revogados
+	devices, err := findActiveDevices(input.DeviceEncryptedContents)
+	if err != nil {
+		return nil, err
+	}
+
+	// Todos os destinatários, inclusive os donos dos dispositivos, devem participar da conversa
+	for recipientID := range input.EncryptedContents {
+		if !containsString(participantIDs, recipientID) {
+			return nil, ErrRecipientNotParticipant
+		}
+	}
+	for _, device := range devices {
+		if !containsString(participantIDs, device.UserID) {
+			return nil, ErrRecipientNotParticipant
+		}
+	}
+
+	// Validar cada texto cifrado contra a chave registrada do destinatário
+	if err := validateContents(input, devices); err != nil {
+		return nil, err
+	}
+
+	version, err := contentsVersion(input)
+	if err != nil {
+		return nil, err
+	}
+
+	message := models.Message{
+		ID:              utils.GenerateUUID(),
+		ConversationID:  input.ConversationID,
+		SenderID:        input.SenderID,
+		ClientMessageID: optionalString(input.ClientMessageID),
+		Type:            models.MessageTypeUser,
+		Version:         version,
+		Epoch:           epoch,
+		CreatedAt:       time.Now(),
+	}
+
+	recipients := make([]models.MessageRecipient, 0, len(input.EncryptedContents)+len(devices))
+	for recipientID, content := range input.EncryptedContents {
+		recipients = append(recipients, models.MessageRecipient{
+			ID:               utils.GenerateUUID(),
+			MessageID:        message.ID,
+			RecipientID:      recipientID,
+			EncryptedContent: content,
+			Status:           models.StatusSent,
+			StatusUpdatedAt:  time.Now(),
+		})
+	}
+	for deviceID, content := range input.DeviceEncryptedContents {
+		recipients = append(recipients, models.MessageRecipient{
+			ID:               utils.GenerateUUID(),
+			MessageID:        message.ID,
+			RecipientID:      devices[deviceID].UserID,
+			DeviceID:         deviceID,
+			EncryptedContent: content,
+			Status:           models.StatusSent,
+			StatusUpdatedAt:  time.Now(),
+		})
+	}
+
+	return saveMessage(message, recipients)
+}
+
+// saveMessage grava a mensagem e seus destinatários na mesma transação, aplicando
+// o temporizador de mensagens temporárias da conversa
+func saveMessage(message models.Message, recipients []models.MessageRecipient) (*models.Message, error) {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var conversation models.Conversation
+		if err := tx.Select("id", "disappearing_seconds").First(&conversation, "id = ?", message.ConversationID).Error; err != nil {
+			return err
+		}
+		message.ExpiresAt = expiryFor(conversation, message.CreatedAt)
+
+		return createMessageRows(tx, &message, recipients)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	message.Recipients = recipients
+	return &message, nil
+}
+
+// createMessageRows insere a mensagem e os destinatários, que expiram junto com ela
+func createMessageRows(tx *gorm.DB, message *models.Message, recipients []models.MessageRecipient) error {
+	seq, err := nextSeq(tx, message.ConversationID)
+	if err != nil {
+		return err
+	}
+	message.Seq = seq
+
+	if err := tx.Create(message).Error; err != nil {
+		return err
+	}
+
+	for i := range recipients {
+		recipients[i].ExpiresAt = message.ExpiresAt
+		if err := tx.Create(&recipients[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextSeq reserva o próximo número de sequência da conversa. Deve ser chamado na mesma
+// transação que insere a mensagem, para que uma falha não deixe lacunas.
+func nextSeq(tx *gorm.DB, conversationID string) (int64, error) {
+	result := tx.Model(&models.Conversation{}).
+		Where("id = ?", conversationID).
+		UpdateColumn("last_seq", gorm.Expr("last_seq + 1"))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	var conversation models.Conversation
+	if err := tx.Select("last_seq").First(&conversation, "id = ?", conversationID).Error; err != nil {
+		return 0, err
+	}
+	return conversation.LastSeq, nil
+}
+
+// findActiveDevices carrega os dispositivos destinatários, falhando se algum não existir ou estiver revogado
+func findActiveDevices(contents map[string]models.ElGamalContent) (map[string]models.Device, error) {
+	result := make(map[string]models.Device, len(contents))
+	if len(contents) == 0 {
+		return result, nil
+	}
+
+	ids := make([]string, 0, len(contents))
+	for id := range contents {
+		ids = append(ids, id)
+	}
+
+	var devices []models.Device
+	if err := config.DB.Where("id IN ?", ids).Find(&devices).Error; err != nil {
+		return nil, err
+	}
+
+	for _, d := range devices {
+		if d.IsRevoked() {
+			return nil, ErrDeviceRevoked
+		}
+		result[d.ID] = d
+	}
+
+	if len(result) != len(ids) {
+		return nil, ErrDeviceNotFound
+	}
+
+	return result, nil
+}
+
+// validateContents confere os textos cifrados com as chaves públicas dos usuários e dispositivos
+func validateContents(input NewMessageInput, devices map[string]models.Device) error {
+	if err := validateUserContents(input.EncryptedContents, "encryptedContents"); err != nil {
+		return err
+	}
+
+	for deviceID, content := range input.DeviceEncryptedContents {
+		if err := validateContent(content, devices[deviceID].PublicKey); err != nil {
+			return prefixValidationError(err, "deviceEncryptedContents."+deviceID)
+		}
+	}
+
+	return nil
+}
+
+// validateUserContents confere conteúdos indexados por usuário com as chaves públicas
+// registradas; field identifica o mapa no payload em caso de erro
+func validateUserContents(contents map[string]models.ElGamalContent, field string) error {
+	if len(contents) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(contents))
+	for id := range contents {
+		ids = append(ids, id)
+	}
+
+	var users []models.User
+	if err := config.DB.Select("id", "public_key").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return err
+	}
+
+	keys := make(map[string]models.PublicKeyData, len(users))
+	for _, u := range users {
+		keys[u.ID] = u.PublicKey
+	}
+
+	for recipientID, content := range contents {
+		key, ok := keys[recipientID]
+		if !ok {
+			return ErrRecipientNotFound
+		}
+		if err := validateContent(content, key); err != nil {
+			return prefixValidationError(err, field+"."+recipientID)
+		}
+	}
+	return nil
+}
+
+// validateContent verifica o formato do envelope e o par (a, b) contra a chave do destinatário
+func validateContent(content models.ElGamalContent, key models.PublicKeyData) error {
+	if err := elgamal.ValidateEnvelope(content.V, content.Nonce, content.CT); err != nil {
+		return err
+	}
+	return elgamal.ValidateCiphertext(content.A, content.B, content.P, key.P)
+}
+
+// contentsVersion retorna a versão comum a todos os conteúdos da mensagem
+func contentsVersion(input NewMessageInput) (int, error) {
+	version := 0
+	check := func(contents map[string]models.ElGamalContent) error {
+		for _, content := range contents {
+			if version == 0 {
+				version = content.Version()
+			} else if content.Version() != version {
+				return ErrMixedVersions
+			}
+		}
+		return nil
+	}
+
+	if err := check(input.EncryptedContents); err != nil {
+		return 0, err
+	}
+	if err := check(input.DeviceEncryptedContents); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// prefixValidationError qualifica o campo de um erro de validação com o caminho no payload
+func prefixValidationError(err error, prefix string) error {
+	var validationErr *elgamal.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.WithPrefix(prefix)
+	}
+	return err
+}
+
+// Limites de paginação do histórico de mensagens
+const (
+	DefaultMessagePageSize = 50
+	MaxMessagePageSize     = 100
+)
+
+var ErrInvalidCursor = errors.New("cursor inválido")
+
+// MessagePage descreve uma consulta paginada ao histórico de uma conversa.
+// Before e After são cursores de sequência mutuamente exclusivos; sem nenhum,
+// retorna as mensagens mais recentes.
+type MessagePage struct {
+	ConversationID string
+	UserID         string
+	Before         string
+	After          string
+	Limit          int
+}
+
+// ListMessages retorna uma página de mensagens endereçadas ao usuário, ordenadas pela sequência.
+// As páginas "before" e a inicial vêm da mais recente para a mais antiga; as páginas "after", o inverso.
+// O segundo retorno indica se há mais mensagens na mesma direção.
+func ListMessages(page MessagePage) ([]models.Message, bool, error) {
+	limit := page.Limit
+	if limit <= 0 {
+		limit = DefaultMessagePageSize
+	}
+	if limit > MaxMessagePageSize {
+		limit = MaxMessagePageSize
+	}
+
+	query := config.DB.
+		Where("conversation_id = ?", page.ConversationID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Where("EXISTS (SELECT 1 FROM message_recipients mr WHERE mr.message_id = messages.id AND mr.recipient_id = ?)", page.UserID).
+		Preload("Recipients", "recipient_id = ?", page.UserID)
+
+	switch {
+	case page.After != "":
+		seq, err := DecodeSeqCursor(page.After)
+		if err != nil {
+			return nil, false, err
+		}
+		query = query.Where("seq > ?", seq).Order("seq ASC")
+	case page.Before != "":
+		seq, err := DecodeSeqCursor(page.Before)
+		if err != nil {
+			return nil, false, err
+		}
+		query = query.Where("seq < ?", seq).Order("seq DESC")
+	default:
+		query = query.Order("seq DESC")
+	}
+
+	// Buscar um item extra para saber se existe próxima página
+	var messages []models.Message
+	if err := query.Limit(limit + 1).Find(&messages).Error; err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	return messages, hasMore, nil
+}
+
+// MaxReplayMessages limita quantas mensagens são reenviadas quando uma conexão é registrada
+const MaxReplayMessages = 500
+
+// PendingMessages retorna as mensagens ainda não entregues ao usuário e, para cada conversa
+// do cursor, todas as endereçadas a ele depois da sequência registrada. As mensagens vêm
+// agrupadas por conversa, em ordem de sequência.
+// O segundo retorno indica se o limite foi atingido e há mais mensagens pendentes.
+func PendingMessages(userID string, cursor SyncCursor) ([]models.Message, bool, error) {
+	undelivered := config.DB.
+		Where("EXISTS (SELECT 1 FROM message_recipients mr WHERE mr.message_id = messages.id AND mr.recipient_id = ? AND mr.status = ?)", userID, models.StatusSent).
+		Where("sender_id <> ?", userID)
+
+	scope := config.DB.Where(undelivered)
+	if len(cursor) > 0 {
+		values, args := cursor.values()
+		addressed := config.DB.
+			Where("EXISTS (SELECT 1 FROM message_recipients mr WHERE mr.message_id = messages.id AND mr.recipient_id = ?)", userID).
+			Where("EXISTS (SELECT 1 FROM ("+values+") c WHERE c.column1 = messages.conversation_id AND messages.seq > c.column2)", args...)
+		scope = scope.Or(addressed)
+	}
+
+	// A ordem por conversa garante que um lote truncado não pule sequências
+	var messages []models.Message
+	if err := config.DB.
+		Where(scope).
+		Where("deleted_at IS NULL").
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Preload("Recipients", "recipient_id = ?", userID).
+		Order("conversation_id ASC, seq ASC").
+		Limit(MaxReplayMessages + 1).
+		Find(&messages).Error; err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(messages) > MaxReplayMessages
+	if hasMore {
+		messages = messages[:MaxReplayMessages]
+	}
+	return messages, hasMore, nil
+}
+
+// PendingUpdates retorna, para cada conversa do cursor, as mensagens já vistas pelo cliente que
+// foram editadas ou apagadas depois da alteração registrada. As apagadas vêm sem conteúdo.
+// As mensagens vêm agrupadas por conversa, na ordem das alterações.
+// O segundo retorno indica se o limite foi atingido e há mais alterações pendentes.
+func PendingUpdates(userID string, cursor SyncCursor) ([]models.Message, bool, error) {
+	if len(cursor) == 0 {
+		return nil, false, nil
+	}
+
+	values, args := cursor.values()
+
+	var messages []models.Message
+	if err := config.DB.
+		Where("EXISTS (SELECT 1 FROM ("+values+") c WHERE c.column1 = messages.conversation_id AND messages.seq <= c.column2 AND messages.change_seq > c.column3)", args...).
+		Where("EXISTS (SELECT 1 FROM message_recipients mr WHERE mr.message_id = messages.id AND mr.recipient_id = ?)", userID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Preload("Recipients", "recipient_id = ?", userID).
+		Order("conversation_id ASC, change_seq ASC").
+		Limit(MaxReplayMessages + 1).
+		Find(&messages).Error; err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(messages) > MaxReplayMessages
+	if hasMore {
+		messages = messages[:MaxReplayMessages]
+	}
+	return messages, hasMore, nil
+}
+
+// EncodeSeqCursor gera o cursor de paginação a partir da posição da mensagem
+func EncodeSeqCursor(m models.Message) string {
+	return strconv.FormatInt(m.Seq, 10)
+}
+
+// DecodeSeqCursor recupera a sequência de um cursor de paginação
+func DecodeSeqCursor(cursor string) (int64, error) {
+	seq, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return seq, nil
+}
+
+// MaxSyncCursorEntries limita quantas conversas um cursor de sincronização pode listar
+const MaxSyncCursorEntries = 1000
+
+// SyncPosition é o ponto de uma conversa já visto pelo cliente: a sequência da última
+// mensagem e a da última edição ou exclusão
+type SyncPosition struct {
+	Seq    int64
+	Change int64
+}
+
+// SyncCursor guarda, por conversa, a posição já vista pelo cliente
+type SyncCursor map[string]SyncPosition
+
+// Advance registra a mensagem no cursor se ela estiver à frente da posição atual
+func (c SyncCursor) Advance(m models.Message) {
+	position := c[m.ConversationID]
+	if m.Seq > position.Seq {
+		position.Seq = m.Seq
+		c[m.ConversationID] = position
+	}
+}
+
+// AdvanceChange registra a edição ou exclusão da mensagem se ela estiver à frente da posição atual
+func (c SyncCursor) AdvanceChange(m models.Message) {
+	position := c[m.ConversationID]
+	if m.ChangeSeq > position.Change {
+		position.Change = m.ChangeSeq
+		c[m.ConversationID] = position
+	}
+}
+
+// Encode serializa o cursor como "conversationId:seq:changeSeq" separados por vírgula, em
+// ordem estável. Conversas sem alterações vistas omitem a última parte.
+func (c SyncCursor) Encode() string {
+	ids := make([]string, 0, len(c))
+	for id := range c {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = id + ":" + strconv.FormatInt(c[id].Seq, 10)
+		if c[id].Change > 0 {
+			parts[i] += ":" + strconv.FormatInt(c[id].Change, 10)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// values monta a lista "VALUES (conversationId, seq, changeSeq), ..." do cursor, cujas colunas o
+// SQLite nomeia column1, column2 e column3. Uma condição OR por conversa esgotaria o limite de
+// profundidade de expressões do SQLite bem antes de MaxSyncCursorEntries.
+func (c SyncCursor) values() (string, []interface{}) {
+	ids := make([]string, 0, len(c))
+	for id := range c {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	rows := make([]string, len(ids))
+	args := make([]interface{}, 0, 3*len(ids))
+	for i, id := range ids {
+		rows[i] = "(?, ?, ?)"
+		args = append(args, id, c[id].Seq, c[id].Change)
+	}
+	return "VALUES " + strings.Join(rows, ", "), args
+}
+
+// DecodeSyncCursor interpreta um cursor gerado por SyncCursor.Encode; vazio resulta em cursor vazio
+func DecodeSyncCursor(cursor string) (SyncCursor, error) {
+	result := SyncCursor{}
+	if cursor == "" {
+		return result, nil
+	}
+
+	parts := strings.Split(cursor, ",")
+	if len(parts) > MaxSyncCursorEntries {
+		return nil, ErrInvalidCursor
+	}
+	for _, part := range parts {
+		fields := strings.Split(part, ":")
+		if len(fields) < 2 || len(fields) > 3 || fields[0] == "" {
+			return nil, ErrInvalidCursor
+		}
+
+		var position SyncPosition
+		var err error
+		if position.Seq, err = DecodeSeqCursor(fields[1]); err != nil {
+			return nil, err
+		}
+		if len(fields) == 3 {
+			if position.Change, err = DecodeSeqCursor(fields[2]); err != nil {
+				return nil, err
+			}
+		}
+		result[fields[0]] = position
+	}
+	return result, nil
+}
+
+// optionalString converte a string vazia em nil, para colunas opcionais
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// containsString indica se o valor está presente na lista
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
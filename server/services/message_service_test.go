@@ -0,0 +1,495 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"server/config"
+	"server/models"
+
+	"gorm.io/gorm"
+)
+
+// seqsByConversation resume mensagens como "conversa:seq", na ordem recebida
+func seqsByConversation(messages []models.Message, names map[string]string) []string {
+	result := make([]string, len(messages))
+	for i, m := range messages {
+		result[i] = names[m.ConversationID] + ":" + EncodeSeqCursor(m)
+	}
+	return result
+}
+
+func assertSequence(t *testing.T, got, want []string) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("mensagens = %v, esperado %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("mensagens = %v, esperado %v", got, want)
+		}
+	}
+}
+
+func TestPendingMessagesGroupsByConversationInSeqOrder(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	first := createTestConversation(t, alice.ID, bob.ID)
+	second := createTestConversation(t, alice.ID, bob.ID)
+	names := map[string]string{first: "primeira", second: "segunda"}
+
+	// Envios intercalados entre as conversas; as mensagens do próprio usuário não voltam
+	sendTestMessage(t, first, alice.ID, alice.ID, bob.ID)
+	sendTestMessage(t, second, alice.ID, alice.ID, bob.ID)
+	sendTestMessage(t, first, bob.ID, alice.ID, bob.ID)
+	sendTestMessage(t, second, alice.ID, alice.ID, bob.ID)
+	sendTestMessage(t, first, alice.ID, alice.ID, bob.ID)
+
+	messages, hasMore, err := PendingMessages(bob.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasMore {
+		t.Error("hasMore sem atingir o limite")
+	}
+	// As conversas vêm na ordem dos IDs
+	want := []string{"primeira:1", "primeira:3", "segunda:1", "segunda:2"}
+	if second < first {
+		want = []string{"segunda:1", "segunda:2", "primeira:1", "primeira:3"}
+	}
+	assertSequence(t, seqsByConversation(messages, names), want)
+}
+
+func TestPendingMessagesResumesAfterCursor(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	conversation := createTestConversation(t, alice.ID, bob.ID)
+	for i := 0; i < 4; i++ {
+		sendTestMessage(t, conversation, alice.ID, alice.ID, bob.ID)
+	}
+
+	// Já entregues, só voltam a partir da sequência do cursor
+	if err := config.DB.Model(&models.MessageRecipient{}).
+		Where("recipient_id = ?", bob.ID).
+		Update("status", models.StatusDelivered).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	messages, _, err := PendingMessages(bob.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 0 {
+		t.Fatalf("sem cursor, %d mensagens entregues reenviadas", len(messages))
+	}
+
+	cursor, err := DecodeSyncCursor(conversation + ":2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, _, err = PendingMessages(bob.ID, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]string{conversation: "c"}
+	assertSequence(t, seqsByConversation(messages, names), []string{"c:3", "c:4"})
+}
+
+func TestPendingMessagesStopsAtLimit(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	conversation := createTestConversation(t, alice.ID, bob.ID)
+	for i := 0; i < MaxReplayMessages+1; i++ {
+		sendTestMessage(t, conversation, alice.ID, bob.ID)
+	}
+
+	messages, hasMore, err := PendingMessages(bob.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasMore || len(messages) != MaxReplayMessages {
+		t.Fatalf("%d mensagens, hasMore = %v; esperado %d e true", len(messages), hasMore, MaxReplayMessages)
+	}
+
+	// O lote truncado termina sem lacunas, e o cursor dele traz o restante
+	cursor := SyncCursor{}
+	for i, m := range messages {
+		if m.Seq != int64(i+1) {
+			t.Fatalf("posição %d tem seq %d", i, m.Seq)
+		}
+		cursor.Advance(m)
+	}
+	if err := config.DB.Model(&models.MessageRecipient{}).
+		Where("recipient_id = ?", bob.ID).
+		Update("status", models.StatusDelivered).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	messages, hasMore, err = PendingMessages(bob.ID, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasMore || len(messages) != 1 || messages[0].Seq != MaxReplayMessages+1 {
+		t.Fatalf("segundo lote: %d mensagens, hasMore = %v", len(messages), hasMore)
+	}
+}
+
+func TestPendingUpdatesReplaysEditsAndDeletes(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	conversation := createTestConversation(t, alice.ID, bob.ID)
+	edited := sendTestMessage(t, conversation, alice.ID, alice.ID, bob.ID)
+	deleted := sendTestMessage(t, conversation, alice.ID, alice.ID, bob.ID)
+	sendTestMessage(t, conversation, alice.ID, alice.ID, bob.ID)
+
+	if _, err := EditMessage(EditMessageInput{
+		ConversationID:    conversation,
+		MessageID:         edited.ID,
+		SenderID:          alice.ID,
+		EncryptedContents: map[string]models.ElGamalContent{alice.ID: testContent(), bob.ID: testContent()},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DeleteMessage(conversation, deleted.ID, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cursor string
+		want   []string
+	}{
+		{conversation + ":3", []string{edited.ID, deleted.ID}},
+		{conversation + ":3:1", []string{deleted.ID}},
+		{conversation + ":3:2", nil},
+		// Mensagens depois da sequência do cursor são reenviadas inteiras, não como alteração
+		{conversation + ":1", []string{edited.ID}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		cursor, err := DecodeSyncCursor(tt.cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		updates, hasMore, err := PendingUpdates(bob.ID, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hasMore || len(updates) != len(tt.want) {
+			t.Fatalf("cursor %q: %d alterações, hasMore = %v; esperado %d", tt.cursor, len(updates), hasMore, len(tt.want))
+		}
+		for i, id := range tt.want {
+			if updates[i].ID != id {
+				t.Errorf("cursor %q: alteração %d = %s, esperado %s", tt.cursor, i, updates[i].ID, id)
+			}
+		}
+	}
+
+	// A exclusão chega sem conteúdo e avança o cursor de alterações
+	cursor, _ := DecodeSyncCursor(conversation + ":3")
+	updates, _, _ := PendingUpdates(bob.ID, cursor)
+	if updates[1].DeletedAt == nil || updates[1].Recipients[0].EncryptedContent.A != "" {
+		t.Error("exclusão reenviada com conteúdo")
+	}
+	for _, m := range updates {
+		cursor.AdvanceChange(m)
+	}
+	if got := cursor.Encode(); got != conversation+":3:2" {
+		t.Errorf("cursor = %s, esperado %s:3:2", got, conversation)
+	}
+}
+
+func TestPendingMessagesAcceptsCursorAtLimit(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	conversation := createTestConversation(t, alice.ID, bob.ID)
+	edited := sendTestMessage(t, conversation, alice.ID, alice.ID, bob.ID)
+	sendTestMessage(t, conversation, alice.ID, alice.ID, bob.ID)
+	sendTestMessage(t, conversation, alice.ID, alice.ID, bob.ID)
+
+	// Entregues: só o cursor as traz de volta
+	if err := config.DB.Model(&models.MessageRecipient{}).Where("recipient_id = ?", bob.ID).Update("status", models.StatusDelivered).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EditMessage(EditMessageInput{
+		ConversationID:    conversation,
+		MessageID:         edited.ID,
+		SenderID:          alice.ID,
+		EncryptedContents: map[string]models.ElGamalContent{alice.ID: testContent(), bob.ID: testContent()},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	full := SyncCursor{conversation: {Seq: 1}}
+	for i := 1; len(full) < MaxSyncCursorEntries; i++ {
+		full[fmt.Sprintf("conversa-%04d", i)] = SyncPosition{Seq: int64(i), Change: int64(i)}
+	}
+	cursor, err := DecodeSyncCursor(full.Encode())
+	if err != nil {
+		t.Fatalf("cursor com %d conversas: %v", MaxSyncCursorEntries, err)
+	}
+
+	messages, _, err := PendingMessages(bob.ID, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSequence(t, seqsByConversation(messages, map[string]string{conversation: "c"}), []string{"c:2", "c:3"})
+
+	updates, _, err := PendingUpdates(bob.ID, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 1 || updates[0].ID != edited.ID {
+		t.Errorf("%d alterações, esperado apenas a edição de %s", len(updates), edited.ID)
+	}
+
+	full["conversa-extra"] = SyncPosition{}
+	if _, err := DecodeSyncCursor(full.Encode()); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("cursor acima do limite: erro = %v", err)
+	}
+}
+
+func TestSyncCursorRoundTrip(t *testing.T) {
+	cursor, err := DecodeSyncCursor("b:7,a:42:3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor["a"] != (SyncPosition{Seq: 42, Change: 3}) || cursor["b"] != (SyncPosition{Seq: 7}) {
+		t.Fatalf("cursor = %v", cursor)
+	}
+	if got := cursor.Encode(); got != "a:42:3,b:7" {
+		t.Errorf("Encode = %s", got)
+	}
+
+	for _, invalid := range []string{"a", ":1", "a:1:2:3", "a:x", "a:1:-1"} {
+		if _, err := DecodeSyncCursor(invalid); err == nil {
+			t.Errorf("cursor %q aceito", invalid)
+		}
+	}
+}
+
+func newTestInput(conversationID, senderID, clientMessageID string, recipientIDs ...string) NewMessageInput {
+	contents := make(map[string]models.ElGamalContent, len(recipientIDs))
+	for _, id := range recipientIDs {
+		contents[id] = testContent()
+	}
+	return NewMessageInput{
+		ConversationID:    conversationID,
+		SenderID:          senderID,
+		EncryptedContents: contents,
+		ClientMessageID:   clientMessageID,
+	}
+}
+
+func countMessages(t *testing.T, conversationID string) int64 {
+	t.Helper()
+
+	var count int64
+	if err := config.DB.Model(&models.Message{}).Where("conversation_id = ?", conversationID).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestCreateMessageRetryReturnsOriginal(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	conversation := createTestConversation(t, alice.ID, bob.ID)
+	input := newTestInput(conversation, alice.ID, "envio-1", alice.ID, bob.ID)
+
+	original, duplicate, err := CreateMessage(input)
+	if err != nil || duplicate {
+		t.Fatalf("primeiro envio: duplicate = %v, erro = %v", duplicate, err)
+	}
+	retry, duplicate, err := CreateMessage(input)
+	if err != nil || !duplicate {
+		t.Fatalf("reenvio: duplicate = %v, erro = %v", duplicate, err)
+	}
+	if retry.ID != original.ID || retry.Seq != original.Seq {
+		t.Errorf("reenvio retornou %s (seq %d), esperado %s (seq %d)", retry.ID, retry.Seq, original.ID, original.Seq)
+	}
+	if n := countMessages(t, conversation); n != 1 {
+		t.Errorf("%d mensagens gravadas, esperado 1", n)
+	}
+
+	// A chave é por remetente: outro usuário pode usar o mesmo valor
+	if _, duplicate, err := CreateMessage(newTestInput(conversation, bob.ID, "envio-1", alice.ID, bob.ID)); err != nil || duplicate {
+		t.Errorf("mesma chave de outro remetente: duplicate = %v, erro = %v", duplicate, err)
+	}
+}
+
+func TestCreateMessageRejectsClientIDFromAnotherConversation(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	first := createTestConversation(t, alice.ID, bob.ID)
+	second := createTestConversation(t, alice.ID, bob.ID)
+
+	if _, _, err := CreateMessage(newTestInput(first, alice.ID, "envio-1", alice.ID, bob.ID)); err != nil {
+		t.Fatal(err)
+	}
+	message, _, err := CreateMessage(newTestInput(second, alice.ID, "envio-1", alice.ID, bob.ID))
+	if !errors.Is(err, ErrClientIDConflict) || message != nil {
+		t.Fatalf("mensagem = %v, erro = %v; esperado ErrClientIDConflict", message, err)
+	}
+	if n := countMessages(t, second); n != 0 {
+		t.Errorf("%d mensagens gravadas na segunda conversa", n)
+	}
+}
+
+func TestCreateMessageConcurrentInsert(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	conversation := createTestConversation(t, alice.ID, bob.ID)
+	input := newTestInput(conversation, alice.ID, "envio-1", alice.ID, bob.ID)
+
+	// Outra tentativa grava a mesma chave logo depois da consulta desta, que então perde a
+	// corrida na inserção
+	var winner *models.Message
+	var once sync.Once
+	err := config.DB.Callback().Query().After("gorm:query").Register("test:concurrent_insert", func(db *gorm.DB) {
+		if db.Statement.Table == "messages" && strings.Contains(db.Statement.SQL.String(), "client_message_id") {
+			once.Do(func() {
+				var err error
+				if winner, err = createMessage(input); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message, duplicate, err := CreateMessage(input)
+	if err != nil || !duplicate {
+		t.Fatalf("tentativa concorrente: duplicate = %v, erro = %v", duplicate, err)
+	}
+	if winner == nil || message.ID != winner.ID {
+		t.Fatalf("tentativa concorrente retornou %s, esperado a mensagem gravada pela outra", message.ID)
+	}
+	if n := countMessages(t, conversation); n != 1 {
+		t.Errorf("%d mensagens gravadas, esperado 1", n)
+	}
+
+	// A sequência reservada pela tentativa recusada é desfeita junto com a transação
+	var conv models.Conversation
+	if err := config.DB.First(&conv, "id = ?", conversation).Error; err != nil {
+		t.Fatal(err)
+	}
+	if conv.LastSeq != 1 {
+		t.Errorf("last_seq = %d, esperado 1", conv.LastSeq)
+	}
+}
+
+func TestCreateMessageAssignsGaplessSeqPerConversation(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	carol := createTestUser(t, "carol")
+	first := createTestConversation(t, alice.ID, bob.ID)
+	second := createTestConversation(t, alice.ID, bob.ID)
+
+	if m := sendTestMessage(t, first, alice.ID, alice.ID, bob.ID); m.Seq != 1 {
+		t.Errorf("primeira mensagem: seq = %d", m.Seq)
+	}
+	if m := sendTestMessage(t, second, bob.ID, alice.ID, bob.ID); m.Seq != 1 {
+		t.Errorf("outra conversa: seq = %d", m.Seq)
+	}
+
+	// Um envio recusado não consome sequência
+	if _, _, err := CreateMessage(newTestInput(first, alice.ID, "", alice.ID, carol.ID)); !errors.Is(err, ErrRecipientNotParticipant) {
+		t.Fatalf("destinatário fora da conversa: erro = %v", err)
+	}
+	if m := sendTestMessage(t, first, bob.ID, alice.ID, bob.ID); m.Seq != 2 {
+		t.Errorf("depois do envio recusado: seq = %d, esperado 2", m.Seq)
+	}
+
+	// Envios simultâneos recebem sequências distintas e sem lacunas
+	const senders = 6
+	var wg sync.WaitGroup
+	seqs := make(chan int64, senders)
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			message, _, err := CreateMessage(newTestInput(first, alice.ID, "", alice.ID, bob.ID))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			seqs <- message.Seq
+		}()
+	}
+	wg.Wait()
+	close(seqs)
+
+	seen := make(map[int64]bool)
+	for seq := range seqs {
+		if seen[seq] || seq < 3 || seq > 2+senders {
+			t.Errorf("seq %d repetida ou fora de 3..%d", seq, 2+senders)
+		}
+		seen[seq] = true
+	}
+}
+
+func TestListMessagesPaginatesBySeq(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	conversation := createTestConversation(t, alice.ID, bob.ID)
+	for i := 0; i < 5; i++ {
+		sendTestMessage(t, conversation, alice.ID, alice.ID, bob.ID)
+	}
+	// Endereçada só à remetente: ocupa a seq 6, mas não aparece para bob
+	sendTestMessage(t, conversation, alice.ID, alice.ID)
+
+	tests := []struct {
+		name          string
+		before, after string
+		want          []int64
+		hasMore       bool
+	}{
+		{"inicial", "", "", []int64{5, 4}, true},
+		{"antes de 4", "4", "", []int64{3, 2}, true},
+		{"antes de 2", "2", "", []int64{1}, false},
+		{"depois de 2", "", "2", []int64{3, 4}, true},
+		{"depois de 4", "", "4", []int64{5}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, hasMore, err := ListMessages(MessagePage{
+				ConversationID: conversation,
+				UserID:         bob.ID,
+				Before:         tt.before,
+				After:          tt.after,
+				Limit:          2,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hasMore != tt.hasMore || len(messages) != len(tt.want) {
+				t.Fatalf("%d mensagens, hasMore = %v; esperado %v e %v", len(messages), hasMore, tt.want, tt.hasMore)
+			}
+			for i, seq := range tt.want {
+				if messages[i].Seq != seq {
+					t.Errorf("posição %d: seq = %d, esperado %d", i, messages[i].Seq, seq)
+				}
+			}
+		})
+	}
+
+	if _, _, err := ListMessages(MessagePage{ConversationID: conversation, UserID: bob.ID, Before: "abc"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("cursor inválido: erro = %v", err)
+	}
+}
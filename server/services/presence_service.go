@@ -0,0 +1,51 @@
+// server/services/presence_service.go
+package services
+
+import (
+	"time"
+
+	"server/config"
+	"server/models"
+)
+
+// PresencePeerIDs retorna os usuários que compartilham alguma conversa com o usuário
+// e, portanto, recebem seus eventos de presença
+func PresencePeerIDs(userID string) ([]string, error) {
+	var ids []string
+	err := config.DB.Model(&models.ConversationParticipant{}).
+		Distinct("user_id").
+		Where("conversation_id IN (?)", config.DB.Model(&models.ConversationParticipant{}).
+			Select("conversation_id").
+			Where("user_id = ?", userID)).
+		Where("user_id <> ?", userID).
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// MarkLastSeen registra o momento em que o usuário foi visto conectado
+func MarkLastSeen(userID string, at time.Time) error {
+	return config.DB.Model(&models.User{}).Where("id = ?", userID).Update("last_seen", at).Error
+}
+
+// VisibleLastSeen retorna o último acesso do usuário, ou nil se ele optou por ocultá-lo
+func VisibleLastSeen(user models.User) *time.Time {
+	if user.HideLastSeen || user.LastSeen.IsZero() {
+		return nil
+	}
+	lastSeen := user.LastSeen
+	return &lastSeen
+}
+
+// HidesLastSeen indica se o usuário ocultou o último acesso
+func HidesLastSeen(userID string) (bool, error) {
+	var user models.User
+	if err := config.DB.Select("id", "hide_last_seen").First(&user, "id = ?", userID).Error; err != nil {
+		return false, err
+	}
+	return user.HideLastSeen, nil
+}
+
+// SetHideLastSeen altera a configuração de privacidade do último acesso
+func SetHideLastSeen(userID string, hide bool) error {
+	return config.DB.Model(&models.User{}).Where("id = ?", userID).Update("hide_last_seen", hide).Error
+}
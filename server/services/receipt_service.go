@@ -0,0 +1,155 @@
+// server/services/receipt_service.go
+package services
+
+import (
+	"errors"
+	"time"
+
+	"server/config"
+	"server/models"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidStatus = errors.New("status inválido")
+
+// Receipt descreve a mudança de status de mensagens de um remetente para um destinatário
+type Receipt struct {
+	ConversationID string    `json:"conversationId"`
+	SenderID       string    `json:"-"`
+	RecipientID    string    `json:"recipientId"`
+	Status         string    `json:"status"`
+	MessageIDs     []string  `json:"messageIds"`
+	At             time.Time `json:"at"`
+}
+
+// statusesBefore retorna os status que podem avançar para o status informado.
+// O status nunca retrocede: uma mensagem lida não volta a ser apenas entregue.
+func statusesBefore(status string) ([]string, error) {
+	switch status {
+	case models.StatusDelivered:
+		return []string{models.StatusSent}, nil
+	case models.StatusRead:
+		return []string{models.StatusSent, models.StatusDelivered}, nil
+	}
+	return nil, ErrInvalidStatus
+}
+
+// MarkDelivered marca a mensagem como entregue ao destinatário. Retorna nil quando
+// não houve mudança, por exemplo se outra conexão do usuário já a recebeu.
+func MarkDelivered(messageID, recipientID string) (*Receipt, error) {
+	receipts, err := advanceStatus(recipientID, models.StatusDelivered,
+		config.DB.Where("messages.id = ?", messageID))
+	if err != nil || len(receipts) == 0 {
+		return nil, err
+	}
+	return &receipts[0], nil
+}
+
+// MarkRead marca como lidas as mensagens informadas ou, com upTo, todas as mensagens
+// da conversa enviadas até a mensagem upTo, inclusive. Retorna um recibo por remetente.
+func MarkRead(conversationID, recipientID string, messageIDs []string, upTo string) ([]Receipt, error) {
+	scope := config.DB.Where("messages.conversation_id = ?", conversationID)
+
+	if upTo != "" {
+		var marker models.Message
+		if err := config.DB.Select("id", "seq").
+			Where("id = ? AND conversation_id = ?", upTo, conversationID).
+			First(&marker).Error; err != nil {
+			return nil, ErrMessageNotFound
+		}
+		scope = scope.Where("messages.seq <= ?", marker.Seq)
+	} else if len(messageIDs) > 0 {
+		scope = scope.Where("messages.id IN ?", messageIDs)
+	} else {
+		return nil, nil
+	}
+
+	return advanceStatus(recipientID, models.StatusRead, scope)
+}
+
+// UpdateRecipientStatus aplica o status informado pelo destinatário via REST
+func UpdateRecipientStatus(messageID, recipientID, status string) (*Receipt, error) {
+	var message models.Message
+	if err := config.DB.Select("messages.id", "messages.conversation_id").
+		Joins("JOIN message_recipients mr ON mr.message_id = messages.id AND mr.recipient_id = ?", recipientID).
+		First(&message, "messages.id = ?", messageID).Error; err != nil {
+		return nil, ErrMessageNotFound
+	}
+
+	var receipts []Receipt
+	var err error
+	if status == models.StatusRead {
+		receipts, err = MarkRead(message.ConversationID, recipientID, []string{messageID}, "")
+	} else {
+		receipts, err = advanceStatus(recipientID, status, config.DB.Where("messages.id = ?", messageID))
+	}
+	if err != nil || len(receipts) == 0 {
+		return nil, err
+	}
+	return &receipts[0], nil
+}
+
+// advanceStatus avança para status as linhas do destinatário nas mensagens selecionadas
+// por scope, ignorando as mensagens que ele mesmo enviou
+func advanceStatus(recipientID, status string, scope *gorm.DB) ([]Receipt, error) {
+	previous, err := statusesBefore(status)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []models.Message
+	if err := config.DB.Model(&models.Message{}).
+		Select("DISTINCT messages.id, messages.conversation_id, messages.sender_id").
+		Joins("JOIN message_recipients mr ON mr.message_id = messages.id").
+		Where("mr.recipient_id = ? AND mr.status IN ?", recipientID, previous).
+		Where("messages.sender_id <> ?", recipientID).
+		Where(scope).
+		Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(messages))
+	for i, m := range messages {
+		ids[i] = m.ID
+	}
+
+	now := time.Now()
+	if err := config.DB.Model(&models.MessageRecipient{}).
+		Where("message_id IN ? AND recipient_id = ? AND status IN ?", ids, recipientID, previous).
+		Updates(map[string]interface{}{
+			"status":            status,
+			"status_updated_at": now,
+		}).Error; err != nil {
+		return nil, err
+	}
+
+	// Um recibo por remetente, pois cada um recebe apenas os próprios
+	bySender := make(map[string]*Receipt)
+	var order []string
+	for _, m := range messages {
+		receipt, ok := bySender[m.SenderID]
+		if !ok {
+			receipt = &Receipt{
+				ConversationID: m.ConversationID,
+				SenderID:       m.SenderID,
+				RecipientID:    recipientID,
+				Status:         status,
+				At:             now,
+			}
+			bySender[m.SenderID] = receipt
+			order = append(order, m.SenderID)
+		}
+		receipt.MessageIDs = append(receipt.MessageIDs, m.ID)
+	}
+
+	receipts := make([]Receipt, 0, len(order))
+	for _, senderID := range order {
+		receipts = append(receipts, *bySender[senderID])
+	}
+	return receipts, nil
+}
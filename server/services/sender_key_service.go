@@ -0,0 +1,188 @@
+// server/services/sender_key_service.go
+package services
+
+import (
+	"errors"
+	"time"
+
+	"server/config"
+	"server/crypto/elgamal"
+	"server/models"
+	"server/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSenderKeyModeDisabled   = errors.New("o grupo não usa chaves de remetente")
+	ErrEpochRequired           = errors.New("informe a época do grupo")
+	ErrSenderKeyIncomplete     = errors.New("a chave de remetente deve ser distribuída a todos os outros membros")
+	ErrSenderKeyNotDistributed = errors.New("chave de remetente não distribuída a todos os membros da época atual")
+)
+
+// SenderKeyDistributionInput reúne a chave de remetente de um membro cifrada para cada outro membro
+type SenderKeyDistributionInput struct {
+	ConversationID string
+	SenderID       string
+	Epoch          int64
+	KeyID          string
+	WrappedKeys    map[string]models.ElGamalContent // userID -> chave cifrada
+}
+
+// DistributeSenderKey registra a chave de remetente para a época atual, substituindo uma
+// distribuição anterior do mesmo membro na mesma época. Retorna os destinatários.
+func DistributeSenderKey(input SenderKeyDistributionInput) ([]string, error) {
+	group, err := FindGroup(config.DB, input.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if !group.SenderKeyMode {
+		return nil, ErrSenderKeyModeDisabled
+	}
+	if input.Epoch != group.Epoch {
+		return nil, ErrStaleEpoch
+	}
+
+	participantIDs, err := ParticipantIDs(input.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(participantIDs, input.SenderID) {
+		return nil, ErrNotParticipant
+	}
+
+	// A distribuição cobre exatamente os outros membros da época
+	recipientIDs := withoutStrings(participantIDs, []string{input.SenderID})
+	for recipientID := range input.WrappedKeys {
+		if !containsString(recipientIDs, recipientID) {
+			return nil, ErrRecipientNotParticipant
+		}
+	}
+	if len(input.WrappedKeys) != len(recipientIDs) {
+		return nil, ErrSenderKeyIncomplete
+	}
+
+	if err := validateUserContents(input.WrappedKeys, "wrappedKeys"); err != nil {
+		return nil, err
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("conversation_id = ? AND sender_id = ? AND epoch = ?", input.ConversationID, input.SenderID, input.Epoch).
+			Delete(&models.SenderKeyDistribution{}).Error; err != nil {
+			return err
+		}
+
+		for recipientID, wrapped := range input.WrappedKeys {
+			distribution := models.SenderKeyDistribution{
+				ID:             utils.GenerateUUID(),
+				ConversationID: input.ConversationID,
+				SenderID:       input.SenderID,
+				RecipientID:    recipientID,
+				Epoch:          input.Epoch,
+				KeyID:          input.KeyID,
+				WrappedKey:     wrapped,
+				CreatedAt:      time.Now(),
+			}
+			if err := tx.Create(&distribution).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recipientIDs, nil
+}
+
+// ListSenderKeys retorna as chaves de remetente cifradas para o usuário, opcionalmente de uma única época.
+// Chaves de épocas anteriores continuam disponíveis para decifrar o histórico.
+func ListSenderKeys(conversationID, recipientID string, epoch *int64) ([]models.SenderKeyDistribution, error) {
+	query := config.DB.Where("conversation_id = ? AND recipient_id = ?", conversationID, recipientID)
+	if epoch != nil {
+		query = query.Where("epoch = ?", *epoch)
+	}
+
+	var distributions []models.SenderKeyDistribution
+	err := query.Order("epoch ASC, created_at ASC").Find(&distributions).Error
+	return distributions, err
+}
+
+// createSenderKeyMessage salva uma mensagem cifrada uma única vez com a chave de remetente.
+// Os MessageRecipient existem apenas para acompanhar o status de entrega e leitura.
+func createSenderKeyMessage(input NewMessageInput, participantIDs []string, epoch int64) (*models.Message, error) {
+	if len(input.EncryptedContents) > 0 || len(input.DeviceEncryptedContents) > 0 {
+		return nil, ErrMixedVersions
+	}
+
+	group, err := FindGroup(config.DB, input.ConversationID)
+	if errors.Is(err, ErrGroupNotFound) {
+		return nil, ErrSenderKeyModeDisabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !group.SenderKeyMode {
+		return nil, ErrSenderKeyModeDisabled
+	}
+	if input.Epoch == nil {
+		return nil, ErrEpochRequired
+	}
+
+	content := input.SenderKeyContent
+	if err := elgamal.ValidateSenderKeyContent(content.KeyID, content.Nonce, content.CT); err != nil {
+		return nil, prefixValidationError(err, "senderKeyContent")
+	}
+
+	if err := requireSenderKey(input.ConversationID, input.SenderID, content.KeyID, epoch, participantIDs); err != nil {
+		return nil, err
+	}
+
+	message := models.Message{
+		ID:               utils.GenerateUUID(),
+		ConversationID:   input.ConversationID,
+		SenderID:         input.SenderID,
+		ClientMessageID:  optionalString(input.ClientMessageID),
+		Type:             models.MessageTypeUser,
+		Version:          elgamal.VersionSenderKey,
+		Epoch:            epoch,
+		SenderKeyContent: content,
+		CreatedAt:        time.Now(),
+	}
+
+	recipients := make([]models.MessageRecipient, 0, len(participantIDs))
+	for _, participantID := range participantIDs {
+		recipients = append(recipients, models.MessageRecipient{
+			ID:              utils.GenerateUUID(),
+			MessageID:       message.ID,
+			RecipientID:     participantID,
+			Status:          models.StatusSent,
+			StatusUpdatedAt: time.Now(),
+		})
+	}
+
+	return saveMessage(message, recipients)
+}
+
+// requireSenderKey exige que a chave informada tenha sido distribuída a todos os
+// outros membros na época atual, para que nenhum membro fique sem conseguir decifrar
+func requireSenderKey(conversationID, senderID, keyID string, epoch int64, participantIDs []string) error {
+	recipientIDs := withoutStrings(participantIDs, []string{senderID})
+	if len(recipientIDs) == 0 {
+		return nil
+	}
+
+	var count int64
+	if err := config.DB.Model(&models.SenderKeyDistribution{}).
+		Where("conversation_id = ? AND sender_id = ? AND epoch = ? AND key_id = ? AND recipient_id IN ?",
+			conversationID, senderID, epoch, keyID, recipientIDs).
+		Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count != int64(len(recipientIDs)) {
+		return ErrSenderKeyNotDistributed
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+// server/services/session_service.go
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"server/config"
+	"server/models"
+	"server/utils"
+
+	"gorm.io/gorm"
+)
+
+// Validade dos tokens de uma sessão
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour // Renovada a cada uso do refresh token
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("refresh token inválido ou expirado")
+	ErrSessionNotFound     = errors.New("sessão não encontrada")
+	ErrSessionRevoked      = errors.New("sessão encerrada")
+)
+
+// SessionTokens é o par de tokens entregue ao cliente ao abrir ou renovar uma sessão
+type SessionTokens struct {
+	SessionID            string
+	AccessToken          string
+	AccessTokenExpiresAt time.Time
+	RefreshToken         string
+}
+
+// CreateSession abre uma nova sessão para o usuário e emite seus tokens
+func CreateSession(userID, userAgent, ip string) (*SessionTokens, error) {
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:               utils.GenerateUUID(),
+		UserID:           userID,
+		RefreshTokenHash: hashRefreshToken(refreshToken),
+		UserAgent:        userAgent,
+		IP:               ip,
+		CreatedAt:        now,
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(RefreshTokenTTL),
+	}
+	if err := config.DB.Create(&session).Error; err != nil {
+		return nil, err
+	}
+
+	return issueTokens(session, refreshToken)
+}
+
+// RefreshSession troca o refresh token por um novo par de tokens. Um refresh token já
+// trocado indica que ele vazou, então a sessão inteira é revogada e retornada junto de
+// ErrInvalidRefreshToken, para que suas conexões sejam encerradas.
+func RefreshSession(refreshToken string) (*SessionTokens, *models.Session, error) {
+	if refreshToken == "" {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	newToken, err := newRefreshToken()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hash := hashRefreshToken(refreshToken)
+	now := time.Now()
+
+	var session models.Session
+	if err := config.DB.Where("refresh_token_hash = ?", hash).First(&session).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, err
+		}
+
+		// Reuso de um token já trocado: revogar a sessão que o emitiu
+		var reused []models.Session
+		if err := config.DB.Where("previous_refresh_hash = ? AND revoked_at IS NULL", hash).
+			Limit(1).Find(&reused).Error; err != nil {
+			return nil, nil, err
+		}
+		if len(reused) == 0 {
+			return nil, nil, ErrInvalidRefreshToken
+		}
+
+		result := config.DB.Model(&models.Session{}).
+			Where("id = ? AND revoked_at IS NULL", reused[0].ID).
+			Update("revoked_at", now)
+		if result.Error != nil {
+			return nil, nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		reused[0].RevokedAt = &now
+		return nil, &reused[0], ErrInvalidRefreshToken
+	}
+
+	if !session.IsActive(now) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	// A troca só vale se o token ainda for o atual, evitando duas renovações simultâneas
+	result := config.DB.Model(&models.Session{}).
+		Where("id = ? AND refresh_token_hash = ?", session.ID, hash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash":    hashRefreshToken(newToken),
+			"previous_refresh_hash": hash,
+			"last_used_at":          now,
+			"expires_at":            now.Add(RefreshTokenTTL),
+		})
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	tokens, err := issueTokens(session, newToken)
+	return tokens, nil, err
+}
+
+// ListSessions retorna as sessões ativas do usuário, da mais recente para a mais antiga
+func ListSessions(userID string) ([]models.Session, error) {
+	var sessions []models.Session
+	err := config.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeSession encerra uma sessão do usuário
+func RevokeSession(userID, sessionID string) error {
+	result := config.DB.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeSessionByRefreshToken encerra a sessão dona do refresh token, usado no logout.
+// Retorna a sessão encerrada.
+func RevokeSessionByRefreshToken(refreshToken string) (*models.Session, error) {
+	var session models.Session
+	if err := config.DB.
+		Where("refresh_token_hash = ? AND revoked_at IS NULL", hashRefreshToken(refreshToken)).
+		First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if err := RevokeSession(session.UserID, session.ID); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RequireActiveSession confirma que a sessão existe, pertence ao usuário e não foi encerrada
+func RequireActiveSession(userID, sessionID string) error {
+	var session models.Session
+	if err := config.DB.Select("id", "user_id", "expires_at", "revoked_at").
+		First(&session, "id = ?", sessionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+
+	if session.UserID != userID || !session.IsActive(time.Now()) {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// issueTokens gera o access token da sessão junto com o refresh token em texto claro
+func issueTokens(session models.Session, refreshToken string) (*SessionTokens, error) {
+	accessToken, expiresAt, err := IssueAccessToken(session.UserID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SessionTokens{
+		SessionID:            session.ID,
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: expiresAt,
+		RefreshToken:         refreshToken,
+	}, nil
+}
+
+// newRefreshToken gera um refresh token aleatório de 256 bits
+func newRefreshToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// hashRefreshToken calcula o valor guardado no banco para um refresh token
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"server/config"
+	"server/models"
+)
+
+// setupTestJWT carrega uma chave HS256 fixa para assinar os access tokens do teste
+func setupTestJWT(t *testing.T) {
+	t.Helper()
+
+	t.Setenv("JWT_KEYS_FILE", "")
+	t.Setenv("JWT_KEYS", "")
+	t.Setenv("JWT_SECRET", "segredo-de-teste-com-pelo-menos-32-bytes")
+	t.Setenv("JWT_KID", "teste")
+
+	keys, err := config.LoadJWTKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := config.JWT
+	config.JWT = keys
+	t.Cleanup(func() { config.JWT = previous })
+}
+
+func TestRefreshSessionRotatesToken(t *testing.T) {
+	setupTestDB(t)
+	setupTestJWT(t)
+	alice := createTestUser(t, "alice")
+
+	created, err := CreateSession(alice.ID, "teste", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refreshed, revoked, err := RefreshSession(created.RefreshToken)
+	if err != nil || revoked != nil {
+		t.Fatalf("renovação: sessão revogada = %v, erro = %v", revoked, err)
+	}
+	if refreshed.SessionID != created.SessionID || refreshed.RefreshToken == created.RefreshToken {
+		t.Fatalf("renovação deveria manter a sessão %s e trocar o refresh token", created.SessionID)
+	}
+
+	claims, err := ParseAccessToken(refreshed.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != alice.ID || claims.SessionID != created.SessionID {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	// O novo token continua renovando a sessão normalmente
+	if _, _, err := RefreshSession(refreshed.RefreshToken); err != nil {
+		t.Errorf("segunda renovação: erro = %v", err)
+	}
+	if err := RequireActiveSession(alice.ID, created.SessionID); err != nil {
+		t.Errorf("sessão deveria seguir ativa: %v", err)
+	}
+}
+
+func TestRefreshSessionReuseRevokesSession(t *testing.T) {
+	setupTestDB(t)
+	setupTestJWT(t)
+	alice := createTestUser(t, "alice")
+
+	created, err := CreateSession(alice.ID, "teste", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshed, _, err := RefreshSession(created.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reapresentar o token já trocado revoga a sessão inteira
+	_, revoked, err := RefreshSession(created.RefreshToken)
+	if !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("reuso: erro = %v", err)
+	}
+	if revoked == nil || revoked.ID != created.SessionID || revoked.UserID != alice.ID || revoked.RevokedAt == nil {
+		t.Fatalf("reuso deveria retornar a sessão revogada, obtido %+v", revoked)
+	}
+
+	var stored models.Session
+	if err := config.DB.First(&stored, "id = ?", created.SessionID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.RevokedAt == nil {
+		t.Error("sessão não foi revogada no banco")
+	}
+	if err := RequireActiveSession(alice.ID, created.SessionID); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("sessão revogada: erro = %v", err)
+	}
+
+	// O token emitido na rotação também deixa de valer
+	if _, _, err := RefreshSession(refreshed.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("token rotacionado após o reuso: erro = %v", err)
+	}
+
+	// Um segundo reuso não revoga de novo nem retorna a sessão
+	if _, revoked, err := RefreshSession(created.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) || revoked != nil {
+		t.Errorf("segundo reuso: sessão = %v, erro = %v", revoked, err)
+	}
+}
+
+func TestRefreshSessionRejectsUnknownToken(t *testing.T) {
+	setupTestDB(t)
+	setupTestJWT(t)
+
+	for _, token := range []string{"", "desconhecido"} {
+		if _, revoked, err := RefreshSession(token); !errors.Is(err, ErrInvalidRefreshToken) || revoked != nil {
+			t.Errorf("token %q: sessão = %v, erro = %v", token, revoked, err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// server/services/token_service.go
+package services
+
+import (
+	"errors"
+	"time"
+
+	"server/config"
+
+	"github.com/golang-jwt/jwt"
+)
+
+var ErrInvalidToken = errors.New("token inválido")
+
+// TokenClaims reúne os dados extraídos de um access token válido
+type TokenClaims struct {
+	UserID    string
+	SessionID string
+	ExpiresAt time.Time
+}
+
+// accessTokenClaims é o corpo de um access token; o usuário vai em sub
+type accessTokenClaims struct {
+	SessionID string `json:"sid"`
+	jwt.StandardClaims
+}
+
+// IssueAccessToken assina o access token de uma sessão com a chave ativa,
+// retornando também sua expiração
+func IssueAccessToken(userID, sessionID string) (string, time.Time, error) {
+	keys := config.JWT
+	now := time.Now()
+	expiresAt := now.Add(AccessTokenTTL)
+
+	token := jwt.NewWithClaims(keys.Active.Method, accessTokenClaims{
+		SessionID: sessionID,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   userID,
+			Issuer:    keys.Issuer,
+			Audience:  keys.Audience,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: expiresAt.Unix(),
+		},
+	})
+	token.Header["kid"] = keys.Active.ID
+
+	signed, err := token.SignedString(keys.Active.SignKey)
+	return signed, expiresAt, err
+}
+
+// ParseAccessToken valida assinatura, kid, algoritmo e as claims exp, iss e aud do token
+func ParseAccessToken(tokenString string) (*TokenClaims, error) {
+	if tokenString == "" {
+		return nil, errors.New("token não fornecido")
+	}
+
+	keys := config.JWT
+	claims := &accessTokenClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys.Keys[kid]
+		if !ok {
+			return nil, errors.New("kid desconhecido")
+		}
+		// O algoritmo é o da chave, nunca o escolhido pelo cabeçalho
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, errors.New("algoritmo de assinatura inesperado")
+		}
+		return key.VerifyKey, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	// StandardClaims.Valid aceita exp, iss e aud ausentes; aqui são obrigatórios
+	now := time.Now().Unix()
+	if !claims.VerifyExpiresAt(now, true) ||
+		!claims.VerifyIssuer(keys.Issuer, true) ||
+		!claims.VerifyAudience(keys.Audience, true) {
+		return nil, ErrInvalidToken
+	}
+
+	// Tokens sem sessão não podem ser revogados e são recusados
+	if claims.Subject == "" || claims.SessionID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return &TokenClaims{
+		UserID:    claims.Subject,
+		SessionID: claims.SessionID,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}, nil
+}
@@ -0,0 +1,410 @@
+// server/services/two_factor_service.go
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"server/config"
+	"server/crypto/totp"
+	"server/models"
+	"server/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// TOTPIssuer identifica a conta no aplicativo autenticador
+	TOTPIssuer = "Chat E2EE"
+	// RecoveryCodeCount é quantos códigos de recuperação são gerados a cada vez
+	RecoveryCodeCount = 10
+	// LoginChallengeTTL define por quanto tempo o segundo passo do login pode ser concluído
+	LoginChallengeTTL = 5 * time.Minute
+	// MaxLoginChallengeAttempts limita os códigos tentados por desafio
+	MaxLoginChallengeAttempts = 5
+	// MaxTwoFactorFailures limita os códigos errados do usuário, somados entre desafios,
+	// antes de bloquear o segundo passo do login por TwoFactorLockout
+	MaxTwoFactorFailures = 10
+	TwoFactorLockout     = 15 * time.Minute
+)
+
+var (
+	ErrTwoFactorAlreadyEnabled = errors.New("autenticação em dois fatores já está ativada")
+	ErrTwoFactorNotEnabled     = errors.New("autenticação em dois fatores não está ativada")
+	ErrTwoFactorNotSetUp       = errors.New("inicie o cadastro do autenticador antes de ativá-lo")
+	ErrInvalidTwoFactorCode    = errors.New("código inválido")
+	ErrInvalidLoginChallenge   = errors.New("desafio de login inválido ou expirado")
+	ErrTwoFactorLocked         = errors.New("muitos códigos inválidos; tente novamente mais tarde")
+)
+
+// recoveryCodeAlphabet evita caracteres ambíguos como 0/O e 1/I
+const recoveryCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// TwoFactorSetup é o segredo pendente e o URI para exibir como QR code
+type TwoFactorSetup struct {
+	Secret string
+	URI    string
+}
+
+// TwoFactorStatus resume a configuração de dois fatores do usuário
+type TwoFactorStatus struct {
+	Enabled                bool
+	RecoveryCodesRemaining int64
+}
+
+// GetTwoFactorStatus informa se o TOTP está ativo e quantos códigos de recuperação restam
+func GetTwoFactorStatus(userID string) (*TwoFactorStatus, error) {
+	var user models.User
+	if err := config.DB.Select("id", "totp_enabled").First(&user, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+
+	status := &TwoFactorStatus{Enabled: user.TOTPEnabled}
+	err := config.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&status.RecoveryCodesRemaining).Error
+	return status, err
+}
+
+// SetupTwoFactor gera um novo segredo pendente. Ele só passa a valer no login depois de
+// confirmado por EnableTwoFactor.
+func SetupTwoFactor(userID string) (*TwoFactorSetup, error) {
+	var user models.User
+	if err := config.DB.Select("id", "username", "totp_enabled").First(&user, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := config.DB.Model(&models.User{}).
+		Where("id = ? AND totp_enabled = ?", userID, false).
+		Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorSetup{
+		Secret: secret,
+		URI:    totp.ProvisioningURI(TOTPIssuer, user.Username, secret),
+	}, nil
+}
+
+// EnableTwoFactor confirma o segredo pendente com um código do autenticador e retorna os
+// códigos de recuperação, exibidos uma única vez
+func EnableTwoFactor(userID, code string) ([]string, error) {
+	var codes []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.First(&user, "id = ?", userID).Error; err != nil {
+			return err
+		}
+		if user.TOTPEnabled {
+			return ErrTwoFactorAlreadyEnabled
+		}
+		if user.TOTPSecret == "" {
+			return ErrTwoFactorNotSetUp
+		}
+
+		step, ok := totp.Validate(user.TOTPSecret, normalizeCode(code), time.Now())
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"totp_enabled": true, "totp_last_step": step}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// RegenerateRecoveryCodes invalida os códigos de recuperação atuais e gera novos
+func RegenerateRecoveryCodes(userID, code string) ([]string, error) {
+	var codes []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(tx, userID, code); err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// DisableTwoFactor desativa o TOTP depois de conferir a senha e um segundo fator
+func DisableTwoFactor(userID, password, code string) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Select("id", "password_hash").First(&user, "id = ?", userID).Error; err != nil {
+			return err
+		}
+		if CheckPasswordHash(password, user.PasswordHash) != nil {
+			return ErrWrongPassword
+		}
+
+		if err := verifySecondFactor(tx, userID, code); err != nil {
+			return err
+		}
+		return resetTwoFactor(tx, userID)
+	})
+}
+
+// ResetTwoFactor remove o TOTP e os códigos de recuperação sem exigir nenhum fator,
+// para uso administrativo quando o usuário perdeu o acesso
+func ResetTwoFactor(userID string) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		return resetTwoFactor(tx, userID)
+	})
+}
+
+func resetTwoFactor(tx *gorm.DB, userID string) error {
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).
+		Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
+
+// verifySecondFactor aceita um código TOTP ainda não usado ou um código de recuperação,
+// que é consumido
+func verifySecondFactor(tx *gorm.DB, userID, code string) error {
+	var user models.User
+	if err := tx.Select("id", "totp_enabled", "totp_secret", "totp_last_step").
+		First(&user, "id = ?", userID).Error; err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	code = normalizeCode(code)
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+		if !ok || step <= user.TOTPLastStep {
+			return ErrInvalidTwoFactorCode
+		}
+
+		// A condição impede que duas requisições simultâneas aceitem o mesmo passo
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", userID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// replaceRecoveryCodes apaga os códigos do usuário e grava novos, retornando-os em texto claro
+func replaceRecoveryCodes(tx *gorm.DB, userID string) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	codes := make([]string, RecoveryCodeCount)
+	records := make([]models.RecoveryCode, RecoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		records[i] = models.RecoveryCode{
+			ID:        utils.GenerateUUID(),
+			UserID:    userID,
+			CodeHash:  hashRecoveryCode(normalizeCode(code)),
+			CreatedAt: now,
+		}
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// newRecoveryCode gera um código de 10 caracteres (50 bits) no formato XXXXX-XXXXX
+func newRecoveryCode() (string, error) {
+	raw := make([]byte, 10)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	code := make([]byte, 0, 11)
+	for i, b := range raw {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		code = append(code, recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+	}
+	return string(code), nil
+}
+
+// normalizeCode remove espaços e hífens e ignora maiúsculas/minúsculas
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// loginChallenge é o segundo passo pendente de um login com senha correta
+type loginChallenge struct {
+	UserID    string
+	ExpiresAt time.Time
+	Attempts  int
+}
+
+// twoFactorFailures conta os códigos errados do usuário em todos os seus desafios, para que
+// um novo login não recomece a contagem
+type twoFactorFailures struct {
+	Count       int
+	LockedUntil time.Time
+}
+
+var (
+	loginChallenges   = make(map[string]*loginChallenge)
+	loginFailures     = make(map[string]*twoFactorFailures) // userID -> falhas
+	loginChallengesMu sync.Mutex
+)
+
+// twoFactorLocked indica se o usuário está bloqueado. Deve ser chamado com loginChallengesMu bloqueado.
+func twoFactorLocked(userID string, now time.Time) bool {
+	f, ok := loginFailures[userID]
+	return ok && now.Before(f.LockedUntil)
+}
+
+// IssueLoginChallenge registra que o usuário acertou a senha e aguarda o segundo fator.
+// Usuários bloqueados por códigos errados recebem ErrTwoFactorLocked.
+func IssueLoginChallenge(userID string) (string, time.Time, error) {
+	loginChallengesMu.Lock()
+	defer loginChallengesMu.Unlock()
+
+	// Remover desafios vencidos que nunca foram concluídos e bloqueios encerrados
+	now := time.Now()
+	for id, c := range loginChallenges {
+		if now.After(c.ExpiresAt) {
+			delete(loginChallenges, id)
+		}
+	}
+	for id, f := range loginFailures {
+		if !f.LockedUntil.IsZero() && now.After(f.LockedUntil) {
+			delete(loginFailures, id)
+		}
+	}
+
+	if twoFactorLocked(userID, now) {
+		return "", time.Time{}, ErrTwoFactorLocked
+	}
+
+	challenge := utils.GenerateUUID()
+	expiresAt := now.Add(LoginChallengeTTL)
+	loginChallenges[challenge] = &loginChallenge{UserID: userID, ExpiresAt: expiresAt}
+
+	return challenge, expiresAt, nil
+}
+
+// CompleteLoginChallenge confere o segundo fator do desafio e retorna o usuário. O desafio
+// é descartado quando concluído, vencido ou após MaxLoginChallengeAttempts tentativas, e o
+// usuário é bloqueado por TwoFactorLockout após MaxTwoFactorFailures códigos errados.
+func CompleteLoginChallenge(challenge, code string) (string, error) {
+	now := time.Now()
+
+	loginChallengesMu.Lock()
+	c, ok := loginChallenges[challenge]
+	if ok && (now.After(c.ExpiresAt) || c.Attempts >= MaxLoginChallengeAttempts) {
+		delete(loginChallenges, challenge)
+		ok = false
+	}
+	if ok && twoFactorLocked(c.UserID, now) {
+		delete(loginChallenges, challenge)
+		loginChallengesMu.Unlock()
+		return "", ErrTwoFactorLocked
+	}
+	if ok {
+		c.Attempts++
+	}
+	loginChallengesMu.Unlock()
+
+	if !ok {
+		return "", ErrInvalidLoginChallenge
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return verifySecondFactor(tx, c.UserID, code)
+	}); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			recordTwoFactorFailure(c.UserID)
+		}
+		return "", err
+	}
+
+	// Só um pedido conclui o desafio, mesmo que dois códigos válidos cheguem juntos
+	loginChallengesMu.Lock()
+	defer loginChallengesMu.Unlock()
+	if _, ok := loginChallenges[challenge]; !ok {
+		return "", ErrInvalidLoginChallenge
+	}
+	delete(loginChallenges, challenge)
+	delete(loginFailures, c.UserID)
+
+	return c.UserID, nil
+}
+
+// recordTwoFactorFailure soma um código errado do usuário e, no limite, bloqueia o segundo
+// passo e descarta os desafios pendentes dele
+func recordTwoFactorFailure(userID string) {
+	loginChallengesMu.Lock()
+	defer loginChallengesMu.Unlock()
+
+	f, ok := loginFailures[userID]
+	if !ok {
+		f = &twoFactorFailures{}
+		loginFailures[userID] = f
+	}
+	f.Count++
+	if f.Count < MaxTwoFactorFailures {
+		return
+	}
+
+	f.Count = 0
+	f.LockedUntil = time.Now().Add(TwoFactorLockout)
+	for id, c := range loginChallenges {
+		if c.UserID == userID {
+			delete(loginChallenges, id)
+		}
+	}
+}
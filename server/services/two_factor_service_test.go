@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"server/crypto/totp"
+)
+
+// enableTestTwoFactor ativa o TOTP do usuário e retorna o segredo e os códigos de recuperação.
+// O passo atual fica consumido pela ativação.
+func enableTestTwoFactor(t *testing.T, userID string) (string, []string) {
+	t.Helper()
+
+	setup, err := SetupTwoFactor(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(setup.Secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveryCodes, err := EnableTwoFactor(userID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return setup.Secret, recoveryCodes
+}
+
+func issueTestChallenge(t *testing.T, userID string) string {
+	t.Helper()
+
+	challenge, _, err := IssueLoginChallenge(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return challenge
+}
+
+func TestLoginChallengeRejectsReplayedStep(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice")
+	secret, _ := enableTestTwoFactor(t, user.ID)
+
+	// O código do passo usado na ativação não vale de novo
+	current, _ := totp.Code(secret, time.Now())
+	challenge := issueTestChallenge(t, user.ID)
+	if _, err := CompleteLoginChallenge(challenge, current); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("passo repetido: erro = %v", err)
+	}
+
+	next, _ := totp.Code(secret, time.Now().Add(totp.Period))
+	userID, err := CompleteLoginChallenge(challenge, next)
+	if err != nil || userID != user.ID {
+		t.Fatalf("próximo passo: usuário = %q, erro = %v", userID, err)
+	}
+
+	// O desafio concluído é descartado, e o passo aceito não vale em outro desafio
+	if _, err := CompleteLoginChallenge(challenge, next); !errors.Is(err, ErrInvalidLoginChallenge) {
+		t.Errorf("desafio reutilizado: erro = %v", err)
+	}
+	if _, err := CompleteLoginChallenge(issueTestChallenge(t, user.ID), next); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("passo aceito reutilizado: erro = %v", err)
+	}
+}
+
+func TestLoginChallengeRecoveryCodeIsSingleUse(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "bob")
+	_, recoveryCodes := enableTestTwoFactor(t, user.ID)
+
+	// Maiúsculas e hífen são ignorados
+	code := strings.ToLower(recoveryCodes[0])
+	if _, err := CompleteLoginChallenge(issueTestChallenge(t, user.ID), code); err != nil {
+		t.Fatalf("código de recuperação: %v", err)
+	}
+	if _, err := CompleteLoginChallenge(issueTestChallenge(t, user.ID), code); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("código de recuperação reutilizado: erro = %v", err)
+	}
+
+	status, err := GetTwoFactorStatus(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.RecoveryCodesRemaining != RecoveryCodeCount-1 {
+		t.Errorf("códigos restantes = %d, esperado %d", status.RecoveryCodesRemaining, RecoveryCodeCount-1)
+	}
+}
+
+func TestTwoFactorFailuresSurviveNewChallenges(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "carol")
+	enableTestTwoFactor(t, user.ID)
+
+	// Cada desafio fica abaixo do próprio limite; a soma entre desafios atinge o do usuário
+	failures := 0
+	for failures < MaxTwoFactorFailures {
+		challenge := issueTestChallenge(t, user.ID)
+		for i := 0; i < MaxLoginChallengeAttempts-1 && failures < MaxTwoFactorFailures; i++ {
+			if _, err := CompleteLoginChallenge(challenge, "000000"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+				t.Fatalf("tentativa %d: erro = %v", failures+1, err)
+			}
+			failures++
+		}
+	}
+
+	if _, _, err := IssueLoginChallenge(user.ID); !errors.Is(err, ErrTwoFactorLocked) {
+		t.Fatalf("novo desafio após %d falhas: erro = %v", failures, err)
+	}
+}
+
+func TestTwoFactorLockRefusesPendingChallenges(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "dave")
+	_, recoveryCodes := enableTestTwoFactor(t, user.ID)
+
+	// Um desafio aberto antes do bloqueio também deixa de aceitar códigos, mesmo válidos
+	pending := issueTestChallenge(t, user.ID)
+	for i := 0; i < MaxTwoFactorFailures; i++ {
+		challenge := issueTestChallenge(t, user.ID)
+		if _, err := CompleteLoginChallenge(challenge, "000000"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("tentativa %d: erro = %v", i+1, err)
+		}
+	}
+
+	if _, err := CompleteLoginChallenge(pending, recoveryCodes[0]); err == nil {
+		t.Fatal("código aceito com o usuário bloqueado")
+	}
+}
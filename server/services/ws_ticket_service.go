@@ -0,0 +1,74 @@
+// server/services/ws_ticket_service.go
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"server/utils"
+)
+
+// WSTicketTTL define por quanto tempo um ticket de WebSocket pode ser usado
+const WSTicketTTL = 30 * time.Second
+
+// wsTicket associa um ticket de uso único ao usuário que o solicitou
+type wsTicket struct {
+	UserID         string
+	SessionID      string
+	TokenExpiresAt time.Time
+	ExpiresAt      time.Time
+}
+
+var (
+	wsTickets   = make(map[string]wsTicket)
+	wsTicketsMu sync.Mutex
+)
+
+// IssueWSTicket gera um ticket de curta duração para autenticar o upgrade do WebSocket.
+// A sessão aberta com o ticket expira junto com o token que o originou.
+func IssueWSTicket(userID, sessionID string, tokenExpiresAt time.Time) (string, time.Time) {
+	wsTicketsMu.Lock()
+	defer wsTicketsMu.Unlock()
+
+	// Remover tickets vencidos que nunca foram usados
+	now := time.Now()
+	for id, t := range wsTickets {
+		if now.After(t.ExpiresAt) {
+			delete(wsTickets, id)
+		}
+	}
+
+	ticket := utils.GenerateUUID()
+	expiresAt := now.Add(WSTicketTTL)
+	wsTickets[ticket] = wsTicket{
+		UserID:         userID,
+		SessionID:      sessionID,
+		TokenExpiresAt: tokenExpiresAt,
+		ExpiresAt:      expiresAt,
+	}
+
+	return ticket, expiresAt
+}
+
+// RedeemWSTicket consome o ticket e retorna o usuário, a sessão e a expiração do token original
+func RedeemWSTicket(ticket string) (*TokenClaims, error) {
+	wsTicketsMu.Lock()
+	defer wsTicketsMu.Unlock()
+
+	t, ok := wsTickets[ticket]
+	if !ok {
+		return nil, errors.New("ticket inválido")
+	}
+	delete(wsTickets, ticket)
+
+	if time.Now().After(t.ExpiresAt) {
+		return nil, errors.New("ticket expirado")
+	}
+
+	return &TokenClaims{
+		UserID:    t.UserID,
+		SessionID: t.SessionID,
+		ExpiresAt: t.TokenExpiresAt,
+	}, nil
+}
@@ -2,9 +2,13 @@ package websocket
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"time"
 
+	"server/crypto/elgamal"
+	"server/services"
+
 	gorilla "github.com/gorilla/websocket"
 )
 
@@ -13,6 +17,9 @@ const (
     pongWait       = 60 * time.Second
     pingPeriod     = (pongWait * 9) / 10
     maxMessageSize = 512 * 1024
+
+    // CloseTokenExpired é enviado quando o token da conexão expira durante a sessão
+    CloseTokenExpired = 4001
 )
 
 func (c *Client) ReadPump() {
@@ -39,29 +46,37 @@ func (c *Client) ReadPump() {
             break
         }
 
-        var wsMessage struct {
-            Type    string          `json:"type"`
-            Payload json.RawMessage `json:"payload"`
-        }
-
-        if err := json.Unmarshal(message, &wsMessage); err != nil {
-            log.Printf("Erro ao decodificar mensagem de %s: %v", c.UserID, err)
+        // Todo frame recebido é respondido com um ack ou um erro com o mesmo requestId
+        frame, err := ParseInboundFrame(message)
+        if err != nil {
+            log.Printf("Frame inválido de %s: %v", c.UserID, err)
+            c.SendError(frame.RequestID, err)
             continue
         }
 
-        log.Printf("Mensagem recebida de %s: tipo=%s", c.UserID, wsMessage.Type)
+        log.Printf("Mensagem recebida de %s: tipo=%s requestId=%s", c.UserID, frame.Type, frame.RequestID)
 
-        if err := c.Hub.HandleMessage(wsMessage.Type, wsMessage.Payload, c.UserID); err != nil {
+        ack, err := c.Hub.HandleMessage(frame.Type, frame.Payload, c.UserID)
+        if err != nil {
             log.Printf("Erro ao processar mensagem de %s: %v", c.UserID, err)
+            c.SendError(frame.RequestID, err)
+            continue
         }
+        if ack == nil {
+            ack = &Ack{Status: AckOK}
+        }
+        ack.RequestID = frame.RequestID
+        c.SendAck(*ack)
     }
 }
 
 // WritePump bombeia mensagens do hub para a conexão websocket
 func (c *Client) WritePump() {
     ticker := time.NewTicker(pingPeriod)
+    expiry := time.NewTimer(time.Until(c.ExpiresAt))
     defer func() {
         ticker.Stop()
+        expiry.Stop()
         c.Conn.Close()
         log.Printf("WritePump encerrado para cliente %s", c.UserID)
     }()
@@ -83,7 +98,7 @@ func (c *Client) WritePump() {
             }
 
             // Verificar se a mensagem é válida antes de enviar
-            var msgCheck map[string]interface{}
+            var msgCheck WSMessage
             if err := json.Unmarshal(message, &msgCheck); err != nil {
                 log.Printf("Mensagem inválida para cliente %s: %v", c.UserID, err)
                 w.Close()
@@ -103,36 +118,126 @@ func (c *Client) WritePump() {
             // Marcar cliente como ativo após envio bem-sucedido
             c.isAlive = true
 
+            // Mensagens escritas na conexão passam a constar como entregues
+            if msgCheck.Type == "message" {
+                var delivered struct {
+                    ID string `json:"id"`
+                }
+                if err := json.Unmarshal(msgCheck.Payload, &delivered); err == nil && delivered.ID != "" {
+                    go c.Hub.messageDelivered(delivered.ID, c.UserID)
+                }
+            }
+
         case <-ticker.C:
             c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
             if err := c.Conn.WriteMessage(gorilla.PingMessage, nil); err != nil {
                 log.Printf("Erro ao enviar ping para cliente %s: %v", c.UserID, err)
                 return
             }
+
+        case <-expiry.C:
+            log.Printf("Token expirado para cliente %s, encerrando conexão", c.UserID)
+            c.Conn.WriteControl(gorilla.CloseMessage,
+                gorilla.FormatCloseMessage(CloseTokenExpired, "token expirado"),
+                time.Now().Add(writeWait))
+            return
         }
     }
 }
 
 // SendAck envia uma confirmação de recebimento para o cliente
-func (c *Client) SendAck(messageID string) {
-    ack := map[string]interface{}{
-        "type": "ack",
-        "payload": map[string]string{
-            "messageId": messageID,
-            "status": "received",
-        },
-    }
-
-    ackBytes, err := json.Marshal(ack)
+func (c *Client) SendAck(ack Ack) {
+    ackBytes, err := encodeFrame("ack", ack)
     if err != nil {
         log.Printf("Erro ao criar ACK: %v", err)
         return
     }
 
+    if c.trySend(ackBytes) {
+        log.Printf("ACK enviado para cliente %s (requisição: %s)", c.UserID, ack.RequestID)
+    } else {
+        log.Printf("Falha ao enviar ACK para cliente %s", c.UserID)
+    }
+}
+
+// trySend enfileira um frame sem bloquear, ignorando conexões já removidas pelo hub
+func (c *Client) trySend(frame []byte) bool {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.closed {
+        return false
+    }
+
     select {
-    case c.Send <- ackBytes:
-        log.Printf("ACK enviado para cliente %s (mensagem: %s)", c.UserID, messageID)
+    case c.Send <- frame:
+        return true
     default:
-        log.Printf("Falha ao enviar ACK para cliente %s", c.UserID)
+        return false
     }
-}
\ No newline at end of file
+}
+
+// SendError informa o cliente de que o processamento do frame requestID falhou.
+// requestID fica vazio quando o frame não pôde ser lido.
+func (c *Client) SendError(requestID string, err error) {
+    code, message := errorFrame(err)
+    frameBytes, err := encodeFrame("error", map[string]string{
+        "requestId": requestID,
+        "code":      code,
+        "message":   message,
+    })
+    if err != nil {
+        log.Printf("Erro ao criar frame de erro: %v", err)
+        return
+    }
+
+    if !c.trySend(frameBytes) {
+        log.Printf("Falha ao enviar erro para cliente %s", c.UserID)
+    }
+}
+
+// errorFrame traduz erros de processamento no código e na mensagem enviados ao cliente
+func errorFrame(err error) (string, string) {
+    var validationErr *elgamal.ValidationError
+    var syntaxErr *json.SyntaxError
+    var typeErr *json.UnmarshalTypeError
+    var protocolErr *ProtocolError
+
+    switch {
+    case errors.As(err, &protocolErr):
+        return protocolErr.Code, protocolErr.Message
+    case errors.Is(err, services.ErrNotParticipant),
+        errors.Is(err, services.ErrPostingRestricted):
+        return "forbidden", err.Error()
+    case errors.As(err, &validationErr):
+        return validationErr.Code, validationErr.Error()
+    case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+        return "invalid_payload", "payload inválido"
+    case errors.Is(err, services.ErrEmptyMessage),
+        errors.Is(err, services.ErrDeviceNotFound),
+        errors.Is(err, services.ErrDeviceRevoked),
+        errors.Is(err, services.ErrRecipientNotFound),
+        errors.Is(err, services.ErrRecipientNotParticipant),
+        errors.Is(err, services.ErrMixedVersions),
+        errors.Is(err, services.ErrInvalidClientID):
+        return "invalid_message", err.Error()
+    case errors.Is(err, services.ErrNotMessageSender):
+        return "forbidden", err.Error()
+    case errors.Is(err, services.ErrMessageNotFound):
+        return "not_found", err.Error()
+    case errors.Is(err, services.ErrMessageDeleted),
+        errors.Is(err, services.ErrRecipientsMismatch):
+        return "invalid_message", err.Error()
+    case errors.Is(err, services.ErrStaleEpoch):
+        return "stale_epoch", err.Error()
+    case errors.Is(err, services.ErrSenderKeyNotDistributed):
+        return "sender_key_missing", err.Error()
+    case errors.Is(err, services.ErrClientIDConflict):
+        return "conflict", err.Error()
+    case errors.Is(err, services.ErrSenderKeyModeDisabled),
+        errors.Is(err, services.ErrEpochRequired):
+        return "invalid_message", err.Error()
+    default:
+        return "internal_error", "erro ao processar mensagem"
+    }
+}
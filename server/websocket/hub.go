@@ -3,35 +3,50 @@ package websocket
 import (
 	"encoding/json"
 	"log"
+	"server/services"
+	"server/utils"
 	"sync"
 	"time"
 
 	gorilla "github.com/gorilla/websocket"
 )
 
-// WSMessage representa uma mensagem WebSocket
+// WSMessage representa uma mensagem WebSocket enviada pelo servidor
 type WSMessage struct {
+    Version int             `json:"v"`
     Type    string          `json:"type"`
     Payload json.RawMessage `json:"payload"`
 }
 
 // Client representa uma conexão WebSocket
 type Client struct {
-    Hub     *Hub
-    UserID  string
-    Conn    *gorilla.Conn
-    Send    chan []byte
-    mu      sync.Mutex
-    isAlive bool
+    Hub          *Hub
+    ID           string // Identificador único da conexão
+    UserID       string
+    DeviceID     string // Dispositivo informado pelo cliente
+    SessionID    string // Sessão de login que autenticou a conexão
+    Conn         *gorilla.Conn
+    Send         chan []byte
+    ExpiresAt    time.Time // Expiração do token usado na autenticação
+    ReplayCursor services.SyncCursor // Última sequência e alteração vistas por conversa; vazio reenvia apenas as não entregues
+    mu           sync.Mutex
+    isAlive      bool
+    closed       bool // Send já foi fechado pelo hub
+    done         chan struct{} // Fechado pelo hub ao remover a conexão, antes de fechar Send
+    sendMu       sync.RWMutex // Envios bloqueantes em andamento impedem o fechamento de Send
+    replaying    bool // Reenviando pendências; frames ao vivo ficam em pending
+    pending      []bufferedFrame
 }
 
 // Hub mantém o registro de clientes ativos e gerencia mensagens
 type Hub struct {
-    Clients    map[string]*Client // userID -> client
+    Clients    map[string]map[string]*Client // userID -> connectionID -> client
     Register   chan *Client
     Unregister chan *Client
     Broadcast  chan BroadcastMessage
     mu         sync.RWMutex
+    typing     map[typingKey]*typingState
+    typingMu   sync.Mutex
 }
 
 type BroadcastMessage struct {
@@ -51,10 +66,11 @@ func NewHub() *Hub {
     defer hubMutex.Unlock()
 
     hub := &Hub{
-        Clients:    make(map[string]*Client),
+        Clients:    make(map[string]map[string]*Client),
         Register:   make(chan *Client),
         Unregister: make(chan *Client),
         Broadcast:  make(chan BroadcastMessage),
+        typing:     make(map[typingKey]*typingState),
     }
 
     globalHub = hub
@@ -79,17 +95,29 @@ func (h *Hub) Run() {
         case client := <-h.Register:
             h.mu.Lock()
             client.isAlive = true
-            h.Clients[client.UserID] = client
+            // Tráfego ao vivo aguarda o reenvio das mensagens pendentes
+            client.replaying = true
+            client.done = make(chan struct{})
+            firstConnection := len(h.Clients[client.UserID]) == 0
+            if h.Clients[client.UserID] == nil {
+                h.Clients[client.UserID] = make(map[string]*Client)
+            }
+            h.Clients[client.UserID][client.ID] = client
             h.mu.Unlock()
-            log.Printf("Cliente %s registrado", client.UserID)
+            log.Printf("Cliente %s registrado (dispositivo: %s)", client.UserID, client.DeviceID)
+
+            go h.replay(client)
+
+            // Presença é anunciada apenas na primeira conexão do usuário
+            if firstConnection {
+                go h.userWentOnline(client.UserID)
+            }
 
         case client := <-h.Unregister:
             h.mu.Lock()
-            if _, ok := h.Clients[client.UserID]; ok {
-                client.isAlive = false
-                delete(h.Clients, client.UserID)
-                close(client.Send)
-                log.Printf("Cliente %s desregistrado", client.UserID)
+            if _, ok := h.Clients[client.UserID][client.ID]; ok {
+                h.removeClient(client)
+                log.Printf("Cliente %s desregistrado (dispositivo: %s)", client.UserID, client.DeviceID)
             }
             h.mu.Unlock()
 
@@ -98,12 +126,7 @@ func (h *Hub) Run() {
                 len(message.Recipients), message.Type, message.MessageID)
 
             // Preparar a mensagem completa com tipo
-            completeMessage := WSMessage{
-                Type:    message.Type,
-                Payload: message.Payload,
-            }
-
-            messageBytes, err := json.Marshal(completeMessage)
+            messageBytes, err := encodeFrame(message.Type, message.Payload)
             if err != nil {
                 log.Printf("Erro ao serializar mensagem para broadcast: %v", err)
                 continue
@@ -112,25 +135,42 @@ func (h *Hub) Run() {
             // Criar um mapa para rastrear entrega
             delivered := make(map[string]bool)
 
-            h.mu.RLock()
+            h.mu.Lock()
             for _, userID := range message.Recipients {
-                if client, ok := h.Clients[userID]; ok && client.isAlive {
+                clients := h.Clients[userID]
+                if len(clients) == 0 {
+                    log.Printf("Cliente %s não está conectado ou inativo", userID)
+                    continue
+                }
+
+                // Enviar para todos os dispositivos conectados do usuário
+                for _, client := range clients {
+                    if !client.isAlive {
+                        continue
+                    }
+                    if buffered, ok := client.bufferIfReplaying(message.Type, message.MessageID, messageBytes); buffered {
+                        if !ok {
+                            log.Printf("Buffer de reenvio cheio para cliente %s (dispositivo: %s), desconectando",
+                                userID, client.DeviceID)
+                            h.removeClient(client)
+                        } else {
+                            delivered[userID] = true
+                        }
+                        continue
+                    }
                     select {
                     case client.Send <- messageBytes:
-                        log.Printf("Mensagem %s enviada para cliente %s",
-                            message.MessageID, userID)
+                        log.Printf("Mensagem %s enviada para cliente %s (dispositivo: %s)",
+                            message.MessageID, userID, client.DeviceID)
                         delivered[userID] = true
                     default:
-                        log.Printf("Buffer cheio para cliente %s, desconectando", userID)
-                        client.isAlive = false
-                        close(client.Send)
-                        delete(h.Clients, userID)
+                        log.Printf("Buffer cheio para cliente %s (dispositivo: %s), desconectando",
+                            userID, client.DeviceID)
+                        h.removeClient(client)
                     }
-                } else {
-                    log.Printf("Cliente %s não está conectado ou inativo", userID)
                 }
             }
-            h.mu.RUnlock()
+            h.mu.Unlock()
 
             // Registrar quem não recebeu a mensagem
             for _, userID := range message.Recipients {
@@ -143,14 +183,90 @@ func (h *Hub) Run() {
         case <-ticker.C:
             // Verificar clientes inativos periodicamente
             h.mu.Lock()
-            for userID, client := range h.Clients {
-                if !client.isAlive {
-                    log.Printf("Removendo cliente inativo: %s", userID)
-                    delete(h.Clients, userID)
-                    close(client.Send)
+            for userID, clients := range h.Clients {
+                for _, client := range clients {
+                    if !client.isAlive {
+                        log.Printf("Removendo cliente inativo: %s (dispositivo: %s)", userID, client.DeviceID)
+                        h.removeClient(client)
+                    }
                 }
             }
             h.mu.Unlock()
         }
     }
 }
+
+// removeClient remove uma conexão específica do usuário e fecha seu canal de envio.
+// Deve ser chamado com h.mu bloqueado.
+func (h *Hub) removeClient(client *Client) {
+    clients := h.Clients[client.UserID]
+    if _, ok := clients[client.ID]; !ok {
+        return
+    }
+
+    client.isAlive = false
+    delete(clients, client.ID)
+
+    // Liberar envios bloqueantes antes de fechar o canal
+    close(client.done)
+    client.sendMu.Lock()
+    client.mu.Lock()
+    client.closed = true
+    close(client.Send)
+    client.mu.Unlock()
+    client.sendMu.Unlock()
+
+    if len(clients) == 0 {
+        delete(h.Clients, client.UserID)
+        // Fora do lock do hub, pois consulta o banco
+        go h.userWentOffline(client.UserID)
+    }
+}
+
+// DisconnectDevice encerra todas as conexões de um dispositivo específico do usuário
+func (h *Hub) DisconnectDevice(userID, deviceID string) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    for _, client := range h.Clients[userID] {
+        if client.DeviceID == deviceID {
+            log.Printf("Desconectando dispositivo %s do cliente %s", deviceID, userID)
+            h.removeClient(client)
+        }
+    }
+}
+
+// DisconnectSession encerra as conexões abertas com os tokens de uma sessão revogada
+func (h *Hub) DisconnectSession(userID, sessionID string) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    for _, client := range h.Clients[userID] {
+        if client.SessionID == sessionID {
+            log.Printf("Desconectando sessão %s do cliente %s", sessionID, userID)
+            h.removeClient(client)
+        }
+    }
+}
+
+// Notify serializa o payload e envia o evento aos usuários sem bloquear quem chama
+func (h *Hub) Notify(eventType string, recipients []string, payload interface{}) {
+    if len(recipients) == 0 {
+        return
+    }
+
+    payloadBytes, err := json.Marshal(payload)
+    if err != nil {
+        log.Printf("Erro ao serializar evento %s: %v", eventType, err)
+        return
+    }
+
+    go func() {
+        h.Broadcast <- BroadcastMessage{
+            Type:       eventType,
+            Recipients: recipients,
+            Payload:    payloadBytes,
+            MessageID:  utils.GenerateUUID(),
+        }
+    }()
+}
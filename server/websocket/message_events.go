@@ -0,0 +1,127 @@
+package websocket
+
+import (
+    "log"
+    "time"
+
+    "server/models"
+    "server/services"
+)
+
+// NotifyMessageEdited envia a cada participante os novos conteúdos endereçados a ele
+func (h *Hub) NotifyMessageEdited(message *models.Message, recipients []string) {
+    for _, userID := range recipients {
+        h.Notify("message_edited", []string{userID}, messageEditedPayload(message, userID))
+    }
+}
+
+// NotifyMessageDeleted avisa os participantes de que a mensagem foi apagada para todos
+func (h *Hub) NotifyMessageDeleted(message *models.Message, recipients []string) {
+    h.Notify("message_deleted", recipients, messageDeletedPayload(message))
+}
+
+// messagePayloadFor monta o payload de "message" com os conteúdos endereçados ao usuário: a
+// entrada dele em encryptedContents e as dos seus dispositivos em deviceEncryptedContents
+func messagePayloadFor(message *models.Message, userID string) map[string]interface{} {
+    encryptedContents := make(map[string]models.ElGamalContent)
+    deviceEncryptedContents := make(map[string]models.ElGamalContent)
+    for _, r := range message.Recipients {
+        if r.RecipientID != userID || message.SenderKeyContent != nil || message.System != nil {
+            continue
+        }
+        if r.DeviceID == "" {
+            encryptedContents[r.RecipientID] = r.EncryptedContent
+        } else {
+            deviceEncryptedContents[r.DeviceID] = r.EncryptedContent
+        }
+    }
+
+    return map[string]interface{}{
+        "id":                      message.ID,
+        "conversationId":          message.ConversationID,
+        "seq":                     message.Seq,
+        "senderId":                message.SenderID,
+        "clientMessageId":         message.ClientMessageID,
+        "type":                    message.Type,
+        "system":                  message.System,
+        "version":                 message.Version,
+        "epoch":                   message.Epoch,
+        "createdAt":               message.CreatedAt.Format(time.RFC3339),
+        "editedAt":                message.EditedAt,
+        "expiresAt":               message.ExpiresAt,
+        "encryptedContents":       encryptedContents,
+        "deviceEncryptedContents": deviceEncryptedContents,
+        "senderKeyContent":        message.SenderKeyContent,
+    }
+}
+
+// messageEditedPayload monta o payload de "message_edited" com os conteúdos endereçados ao usuário
+func messageEditedPayload(message *models.Message, userID string) map[string]interface{} {
+    encryptedContents := make(map[string]models.ElGamalContent)
+    deviceEncryptedContents := make(map[string]models.ElGamalContent)
+    for _, r := range message.Recipients {
+        if r.RecipientID != userID || message.SenderKeyContent != nil {
+            continue
+        }
+        if r.DeviceID == "" {
+            encryptedContents[r.RecipientID] = r.EncryptedContent
+        } else {
+            deviceEncryptedContents[r.DeviceID] = r.EncryptedContent
+        }
+    }
+
+    return map[string]interface{}{
+        "id":                      message.ID,
+        "conversationId":          message.ConversationID,
+        "seq":                     message.Seq,
+        "changeSeq":               message.ChangeSeq,
+        "senderId":                message.SenderID,
+        "version":                 message.Version,
+        "epoch":                   message.Epoch,
+        "editedAt":                message.EditedAt.Format(time.RFC3339),
+        "encryptedContents":       encryptedContents,
+        "deviceEncryptedContents": deviceEncryptedContents,
+        "senderKeyContent":        message.SenderKeyContent,
+    }
+}
+
+// messageDeletedPayload monta o payload de "message_deleted"
+func messageDeletedPayload(message *models.Message) map[string]interface{} {
+    return map[string]interface{}{
+        "id":             message.ID,
+        "conversationId": message.ConversationID,
+        "seq":            message.Seq,
+        "changeSeq":      message.ChangeSeq,
+        "senderId":       message.SenderID,
+        "deletedAt":      message.DeletedAt.Format(time.RFC3339),
+    }
+}
+
+// NotifyMessagesExpired pede aos participantes que apaguem as cópias locais das mensagens expiradas
+func (h *Hub) NotifyMessagesExpired(conversationID string, messageIDs []string) {
+    participantIDs, err := services.ParticipantIDs(conversationID)
+    if err != nil {
+        log.Printf("Erro ao buscar participantes da conversa %s: %v", conversationID, err)
+        return
+    }
+
+    h.Notify("messages_expired", participantIDs, map[string]interface{}{
+        "conversationId": conversationID,
+        "messageIds":     messageIDs,
+    })
+}
+
+// NotifySystemMessage entrega uma mensagem de sistema aos participantes como uma mensagem comum
+func (h *Hub) NotifySystemMessage(message *models.Message, recipients []string) {
+    h.Notify("message", recipients, map[string]interface{}{
+        "id":             message.ID,
+        "conversationId": message.ConversationID,
+        "seq":            message.Seq,
+        "senderId":       message.SenderID,
+        "type":           message.Type,
+        "system":         message.System,
+        "createdAt":      message.CreatedAt.Format(time.RFC3339),
+        "expiresAt":      message.ExpiresAt,
+    })
+    h.Notify("conversation_update", recipients, map[string]interface{}{})
+}
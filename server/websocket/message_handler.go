@@ -5,131 +5,88 @@ import (
 	"log"
 	"server/config"
 	"server/models"
+	"server/services"
 	"server/utils"
-	"time"
 )
 
-type WSMessagePayload struct {
-    ConversationID    string                           `json:"conversationId"`
-    SenderID          string                           `json:"senderId"`
-    EncryptedContents map[string]models.ElGamalContent `json:"encryptedContents"`
+// Ack confirma à conexão remetente que um frame foi processado
+type Ack struct {
+    RequestID       string `json:"requestId"`
+    MessageID       string `json:"messageId,omitempty"`
+    ClientMessageID string `json:"clientMessageId,omitempty"`
+    Status          string `json:"status"` // AckOK, AckCreated ou AckDuplicate
 }
 
-func ProcessMessage(messageBytes []byte) error {
-    var wsMessage struct {
-        Type    string          `json:"type"`
-        Payload json.RawMessage `json:"payload"`
-    }
-
-    if err := json.Unmarshal(messageBytes, &wsMessage); err != nil {
-        return err
-    }
-
-    if wsMessage.Type == "message" {
-        var payload WSMessagePayload
-        if err := json.Unmarshal(wsMessage.Payload, &payload); err != nil {
-            return err
-        }
-
-        // Criar a mensagem no banco
-        message := models.Message{
-            ID:             utils.GenerateUUID(),
-            ConversationID: payload.ConversationID,
-            SenderID:       payload.SenderID,
-            CreatedAt:      time.Now(),
-        }
-
-        tx := config.DB.Begin()
-
-        if err := tx.Create(&message).Error; err != nil {
-            tx.Rollback()
-            return err
-        }
-
-        // Salvar os conteúdos criptografados para cada destinatário
-        for recipientID, content := range payload.EncryptedContents {
-            recipient := models.MessageRecipient{
-                ID:               utils.GenerateUUID(),
-                MessageID:        message.ID,
-                RecipientID:     recipientID,
-                EncryptedContent: content,
-            }
-
-            if err := tx.Create(&recipient).Error; err != nil {
-                tx.Rollback()
-                return err
-            }
-        }
-
-        return tx.Commit().Error
-    }
-
-    return nil
-}
+const (
+    AckOK        = "ok"        // Frame processado sem criar mensagem
+    AckCreated   = "created"   // Mensagem persistida
+    AckDuplicate = "duplicate" // Reenvio com clientMessageId já usado; nada foi criado
+)
 
-func (h *Hub) HandleMessage(messageType string, payload json.RawMessage, senderID string) error {
+// HandleMessage processa um frame recebido do usuário. O Ack retornado, quando
+// presente, detalha o resultado; sem ele, o frame é confirmado com AckOK.
+func (h *Hub) HandleMessage(messageType string, payload json.RawMessage, senderID string) (*Ack, error) {
     log.Printf("HandleMessage chamado - Type: %s, SenderID: %s", messageType, senderID)
     log.Printf("Payload recebido: %s", string(payload))
 
     switch messageType {
     case "message":
         var messagePayload struct {
-            ConversationID    string                           `json:"conversationId"`
-            EncryptedContents map[string]models.ElGamalContent `json:"encryptedContents"`
+            ConversationID          string                           `json:"conversationId"`
+            EncryptedContents       map[string]models.ElGamalContent `json:"encryptedContents"`
+            DeviceEncryptedContents map[string]models.ElGamalContent `json:"deviceEncryptedContents"`
+            Epoch                   *int64                           `json:"epoch"`
+            SenderKeyContent        *models.SenderKeyContent         `json:"senderKeyContent"`
+            ClientMessageID         string                           `json:"clientMessageId"`
         }
 
         if err := json.Unmarshal(payload, &messagePayload); err != nil {
             log.Printf("Erro ao decodificar payload: %v", err)
-            return err
+            return nil, err
         }
 
         log.Printf("Mensagem decodificada - ConversationID: %s", messagePayload.ConversationID)
 
+        // Somente participantes podem enviar mensagens para a conversa
+        if err := services.RequireParticipant(messagePayload.ConversationID, senderID); err != nil {
+            log.Printf("Remetente %s não autorizado na conversa %s", senderID, messagePayload.ConversationID)
+            return nil, err
+        }
+
         // Buscar participantes da conversa
         var conversation models.Conversation
         if err := config.DB.Preload("Participants").First(&conversation, "id = ?", messagePayload.ConversationID).Error; err != nil {
             log.Printf("Erro ao buscar conversa: %v", err)
-            return err
+            return nil, err
         }
 
         // Criar a mensagem no banco
-        messageID := utils.GenerateUUID()
-        message := models.Message{
-            ID:             messageID,
-            ConversationID: messagePayload.ConversationID,
-            SenderID:       senderID,
-            CreatedAt:      time.Now(),
-        }
-
-        tx := config.DB.Begin()
-
-        if err := tx.Create(&message).Error; err != nil {
-            tx.Rollback()
+        message, duplicate, err := services.CreateMessage(services.NewMessageInput{
+            ConversationID:          messagePayload.ConversationID,
+            SenderID:                senderID,
+            EncryptedContents:       messagePayload.EncryptedContents,
+            DeviceEncryptedContents: messagePayload.DeviceEncryptedContents,
+            Epoch:                   messagePayload.Epoch,
+            SenderKeyContent:        messagePayload.SenderKeyContent,
+            ClientMessageID:         messagePayload.ClientMessageID,
+        })
+        if err != nil {
             log.Printf("Erro ao criar mensagem: %v", err)
-            return err
-        }
-
-        // Salvar os conteúdos criptografados para cada destinatário
-        for recipientID, content := range messagePayload.EncryptedContents {
-            recipient := models.MessageRecipient{
-                ID:               utils.GenerateUUID(),
-                MessageID:        message.ID,
-                RecipientID:      recipientID,
-                EncryptedContent: content,
-                Status:           "SENT",
-                StatusUpdatedAt:  time.Now(),
-            }
+            return nil, err
+        }
+        messageID := message.ID
 
-            if err := tx.Create(&recipient).Error; err != nil {
-                tx.Rollback()
-                log.Printf("Erro ao criar destinatário: %v", err)
-                return err
-            }
+        ack := &Ack{
+            MessageID:       message.ID,
+            ClientMessageID: messagePayload.ClientMessageID,
+            Status:          AckCreated,
         }
 
-        if err := tx.Commit().Error; err != nil {
-            log.Printf("Erro ao commit da transação: %v", err)
-            return err
+        // O original já foi distribuído; o reenvio apenas recebe a confirmação
+        if duplicate {
+            log.Printf("Mensagem %s reenviada por %s (clientMessageId: %s)", messageID, senderID, messagePayload.ClientMessageID)
+            ack.Status = AckDuplicate
+            return ack, nil
         }
 
         // Obter lista de IDs dos participantes
@@ -138,34 +95,27 @@ func (h *Hub) HandleMessage(messageType string, payload json.RawMessage, senderI
             recipientIDs[i] = participant.UserID
         }
 
-        // Broadcast para todos os participantes
-        broadcastPayload := map[string]interface{}{
-            "id":               message.ID,
-            "conversationId":   message.ConversationID,
-            "senderId":         senderID,
-            "createdAt":        message.CreatedAt.Format(time.RFC3339),
-            "encryptedContents": messagePayload.EncryptedContents,
-        }
+        // Enviar a mensagem encerra o indicador de digitação
+        h.stopTyping(messagePayload.ConversationID, senderID)
 
-        payloadBytes, err := json.Marshal(broadcastPayload)
-        if err != nil {
-            log.Printf("Erro ao serializar payload: %v", err)
-            return err
-        }
+        log.Printf("Enviando mensagem %s para %d destinatários", messageID, len(recipientIDs))
 
-        log.Printf("Enviando broadcast para %d destinatários (mensagem ID: %s)",
-            len(recipientIDs), messageID)
+        // Cada participante recebe apenas o próprio conteúdo e os dos seus dispositivos
+        for _, recipientID := range recipientIDs {
+            payloadBytes, err := json.Marshal(messagePayloadFor(message, recipientID))
+            if err != nil {
+                log.Printf("Erro ao serializar payload: %v", err)
+                return nil, err
+            }
 
-        // Enviar a mensagem apenas uma vez
-        broadcastMessage := BroadcastMessage{
-            Type:       "message",
-            Recipients: recipientIDs,
-            Payload:    payloadBytes,
-            MessageID:  messageID,
+            h.Broadcast <- BroadcastMessage{
+                Type:       "message",
+                Recipients: []string{recipientID},
+                Payload:    payloadBytes,
+                MessageID:  messageID,
+            }
         }
 
-        h.Broadcast <- broadcastMessage
-
         // Notificar atualização de conversa
         updateNotification := BroadcastMessage{
             Type:       "conversation_update",
@@ -175,7 +125,119 @@ func (h *Hub) HandleMessage(messageType string, payload json.RawMessage, senderI
         }
 
         h.Broadcast <- updateNotification
+
+        return ack, nil
+
+    case "edit_message":
+        var editPayload struct {
+            ConversationID          string                           `json:"conversationId"`
+            MessageID               string                           `json:"messageId"`
+            EncryptedContents       map[string]models.ElGamalContent `json:"encryptedContents"`
+            DeviceEncryptedContents map[string]models.ElGamalContent `json:"deviceEncryptedContents"`
+            SenderKeyContent        *models.SenderKeyContent         `json:"senderKeyContent"`
+        }
+
+        if err := json.Unmarshal(payload, &editPayload); err != nil {
+            log.Printf("Erro ao decodificar payload: %v", err)
+            return nil, err
+        }
+
+        if err := services.RequireParticipant(editPayload.ConversationID, senderID); err != nil {
+            return nil, err
+        }
+
+        message, err := services.EditMessage(services.EditMessageInput{
+            ConversationID:          editPayload.ConversationID,
+            MessageID:               editPayload.MessageID,
+            SenderID:                senderID,
+            EncryptedContents:       editPayload.EncryptedContents,
+            DeviceEncryptedContents: editPayload.DeviceEncryptedContents,
+            SenderKeyContent:        editPayload.SenderKeyContent,
+        })
+        if err != nil {
+            log.Printf("Erro ao editar mensagem: %v", err)
+            return nil, err
+        }
+
+        participantIDs, err := services.ParticipantIDs(message.ConversationID)
+        if err != nil {
+            return nil, err
+        }
+        h.NotifyMessageEdited(message, participantIDs)
+
+    case "read":
+        var readPayload struct {
+            ConversationID string   `json:"conversationId"`
+            MessageIDs     []string `json:"messageIds"`
+            UpTo           string   `json:"upTo"` // Marca como lidas todas as mensagens até esta, inclusive
+        }
+
+        if err := json.Unmarshal(payload, &readPayload); err != nil {
+            return nil, err
+        }
+
+        if err := services.RequireParticipant(readPayload.ConversationID, senderID); err != nil {
+            return nil, err
+        }
+
+        receipts, err := services.MarkRead(readPayload.ConversationID, senderID, readPayload.MessageIDs, readPayload.UpTo)
+        if err != nil {
+            return nil, err
+        }
+        h.SendReceipts(receipts)
+
+        // Os outros dispositivos do leitor atualizam a contagem de não lidas
+        if len(receipts) > 0 {
+            h.Notify("conversation_update", []string{senderID}, map[string]interface{}{})
+        }
+
+    case "typing_start", "typing_stop":
+        var typingPayload struct {
+            ConversationID string `json:"conversationId"`
+        }
+
+        if err := json.Unmarshal(payload, &typingPayload); err != nil {
+            return nil, err
+        }
+
+        if err := services.RequireParticipant(typingPayload.ConversationID, senderID); err != nil {
+            return nil, err
+        }
+
+        // Indicadores de digitação são apenas repassados, nunca persistidos
+        if messageType == "typing_start" {
+            h.startTyping(typingPayload.ConversationID, senderID)
+        } else {
+            h.stopTyping(typingPayload.ConversationID, senderID)
+        }
+
+    case "delete_message":
+        var deletePayload struct {
+            ConversationID string `json:"conversationId"`
+            MessageID      string `json:"messageId"`
+        }
+
+        if err := json.Unmarshal(payload, &deletePayload); err != nil {
+            log.Printf("Erro ao decodificar payload: %v", err)
+            return nil, err
+        }
+
+        if err := services.RequireParticipant(deletePayload.ConversationID, senderID); err != nil {
+            return nil, err
+        }
+
+        message, err := services.DeleteMessage(deletePayload.ConversationID, deletePayload.MessageID, senderID)
+        if err != nil {
+            log.Printf("Erro ao apagar mensagem: %v", err)
+            return nil, err
+        }
+
+        participantIDs, err := services.ParticipantIDs(message.ConversationID)
+        if err != nil {
+            return nil, err
+        }
+        h.NotifyMessageDeleted(message, participantIDs)
     }
 
-    return nil
+    return nil, nil
 }
@@ -0,0 +1,171 @@
+package websocket
+
+import (
+    "log"
+    "time"
+
+    "server/services"
+)
+
+// TypingTTL é o tempo sem novo typing_start após o qual o indicador expira
+const TypingTTL = 6 * time.Second
+
+// typingKey identifica um usuário digitando em uma conversa
+type typingKey struct {
+    conversationID string
+    userID         string
+}
+
+// typingState guarda o prazo do indicador; typing_start repetidos apenas o estendem
+type typingState struct {
+    timer    *time.Timer
+    deadline time.Time
+}
+
+// startTyping registra que o usuário está digitando e avisa os demais participantes
+// apenas na primeira vez; chamadas seguintes renovam o prazo de expiração
+func (h *Hub) startTyping(conversationID, userID string) {
+    key := typingKey{conversationID, userID}
+
+    h.typingMu.Lock()
+    if state, ok := h.typing[key]; ok {
+        state.deadline = time.Now().Add(TypingTTL)
+        h.typingMu.Unlock()
+        return
+    }
+    h.typing[key] = &typingState{
+        timer:    time.AfterFunc(TypingTTL, func() { h.expireTyping(key) }),
+        deadline: time.Now().Add(TypingTTL),
+    }
+    h.typingMu.Unlock()
+
+    h.relayTyping("typing_start", key)
+}
+
+// stopTyping encerra o indicador, se ativo, e avisa os demais participantes
+func (h *Hub) stopTyping(conversationID, userID string) {
+    key := typingKey{conversationID, userID}
+
+    h.typingMu.Lock()
+    state, ok := h.typing[key]
+    if !ok {
+        h.typingMu.Unlock()
+        return
+    }
+    state.timer.Stop()
+    delete(h.typing, key)
+    h.typingMu.Unlock()
+
+    h.relayTyping("typing_stop", key)
+}
+
+// expireTyping é chamado pelo timer; reagenda se o prazo foi estendido
+func (h *Hub) expireTyping(key typingKey) {
+    h.typingMu.Lock()
+    state, ok := h.typing[key]
+    if !ok {
+        h.typingMu.Unlock()
+        return
+    }
+    if remaining := time.Until(state.deadline); remaining > 0 {
+        state.timer.Reset(remaining)
+        h.typingMu.Unlock()
+        return
+    }
+    delete(h.typing, key)
+    h.typingMu.Unlock()
+
+    h.relayTyping("typing_stop", key)
+}
+
+// stopAllTyping encerra os indicadores do usuário em todas as conversas
+func (h *Hub) stopAllTyping(userID string) {
+    h.typingMu.Lock()
+    var conversationIDs []string
+    for key := range h.typing {
+        if key.userID == userID {
+            conversationIDs = append(conversationIDs, key.conversationID)
+        }
+    }
+    h.typingMu.Unlock()
+
+    for _, conversationID := range conversationIDs {
+        h.stopTyping(conversationID, userID)
+    }
+}
+
+// relayTyping repassa o evento aos outros participantes sem persisti-lo
+func (h *Hub) relayTyping(eventType string, key typingKey) {
+    participantIDs, err := services.ParticipantIDs(key.conversationID)
+    if err != nil {
+        log.Printf("Erro ao buscar participantes da conversa %s: %v", key.conversationID, err)
+        return
+    }
+
+    recipients := make([]string, 0, len(participantIDs))
+    for _, id := range participantIDs {
+        if id != key.userID {
+            recipients = append(recipients, id)
+        }
+    }
+
+    h.Notify(eventType, recipients, map[string]interface{}{
+        "conversationId": key.conversationID,
+        "userId":         key.userID,
+    })
+}
+
+// IsOnline indica se o usuário tem alguma conexão ativa
+func (h *Hub) IsOnline(userID string) bool {
+    h.mu.RLock()
+    defer h.mu.RUnlock()
+    return len(h.Clients[userID]) > 0
+}
+
+// userWentOnline avisa quem compartilha conversas com o usuário de que ele está conectado
+func (h *Hub) userWentOnline(userID string) {
+    if err := services.MarkLastSeen(userID, time.Now()); err != nil {
+        log.Printf("Erro ao atualizar último acesso de %s: %v", userID, err)
+    }
+
+    h.notifyPresence(userID, map[string]interface{}{
+        "userId": userID,
+        "status": "online",
+    })
+}
+
+// userWentOffline registra o último acesso, encerra os indicadores de digitação e,
+// se o usuário não reconectou nesse meio tempo, avisa que ele ficou offline
+func (h *Hub) userWentOffline(userID string) {
+    now := time.Now()
+    if err := services.MarkLastSeen(userID, now); err != nil {
+        log.Printf("Erro ao atualizar último acesso de %s: %v", userID, err)
+    }
+
+    h.stopAllTyping(userID)
+
+    if h.IsOnline(userID) {
+        return
+    }
+
+    payload := map[string]interface{}{
+        "userId":   userID,
+        "status":   "offline",
+        "lastSeen": now.Format(time.RFC3339),
+    }
+    if hidden, err := services.HidesLastSeen(userID); err != nil || hidden {
+        payload["lastSeen"] = nil
+    }
+
+    h.notifyPresence(userID, payload)
+}
+
+// notifyPresence envia o evento de presença aos usuários relacionados
+func (h *Hub) notifyPresence(userID string, payload map[string]interface{}) {
+    peers, err := services.PresencePeerIDs(userID)
+    if err != nil {
+        log.Printf("Erro ao buscar contatos de presença de %s: %v", userID, err)
+        return
+    }
+    h.Notify("presence", peers, payload)
+}
@@ -0,0 +1,109 @@
+package websocket
+
+import (
+    "encoding/json"
+    "fmt"
+)
+
+// ProtocolVersion é a versão do esquema de frames documentado em docs/protocolo-websocket.md.
+// Alterações incompatíveis nos frames exigem incrementar este valor.
+const ProtocolVersion = 1
+
+// MaxRequestIDLength limita o identificador de requisição escolhido pelo cliente
+const MaxRequestIDLength = 64
+
+// Códigos de erro do próprio protocolo, enviados antes de o frame chegar ao hub
+const (
+    CodeInvalidFrame       = "invalid_frame"
+    CodeUnsupportedVersion = "unsupported_version"
+    CodeUnknownType        = "unknown_type"
+    CodeMissingRequestID   = "missing_request_id"
+    CodeInvalidPayload     = "invalid_payload"
+)
+
+// inboundFields lista, para cada tipo de frame aceito do cliente, os campos obrigatórios do payload
+var inboundFields = map[string][]string{
+    "message":        {"conversationId"},
+    "edit_message":   {"conversationId", "messageId"},
+    "delete_message": {"conversationId", "messageId"},
+    "read":           {"conversationId"},
+    "typing_start":   {"conversationId"},
+    "typing_stop":    {"conversationId"},
+}
+
+// InboundFrame é um frame enviado pelo cliente
+type InboundFrame struct {
+    Version   int             `json:"v"`
+    Type      string          `json:"type"`
+    RequestID string          `json:"requestId"`
+    Payload   json.RawMessage `json:"payload"`
+}
+
+// ProtocolError indica um frame que não segue o esquema do protocolo
+type ProtocolError struct {
+    Code    string
+    Message string
+}
+
+func (e *ProtocolError) Error() string {
+    return e.Message
+}
+
+// ParseInboundFrame decodifica e valida um frame do cliente. Quando o frame é inválido,
+// o RequestID retornado ainda é preenchido se pôde ser lido, para ecoar no erro.
+func ParseInboundFrame(data []byte) (InboundFrame, error) {
+    var frame InboundFrame
+    if err := json.Unmarshal(data, &frame); err != nil {
+        return frame, &ProtocolError{CodeInvalidFrame, "frame não é um JSON válido"}
+    }
+
+    if frame.RequestID == "" {
+        return frame, &ProtocolError{CodeMissingRequestID, "requestId é obrigatório"}
+    }
+    if len(frame.RequestID) > MaxRequestIDLength {
+        requestID := frame.RequestID
+        frame.RequestID = ""
+        return frame, &ProtocolError{CodeInvalidFrame,
+            fmt.Sprintf("requestId deve ter no máximo %d caracteres (recebido %d)", MaxRequestIDLength, len(requestID))}
+    }
+
+    if frame.Version != ProtocolVersion {
+        return frame, &ProtocolError{CodeUnsupportedVersion,
+            fmt.Sprintf("versão de protocolo %d não suportada; use %d", frame.Version, ProtocolVersion)}
+    }
+
+    required, ok := inboundFields[frame.Type]
+    if !ok {
+        return frame, &ProtocolError{CodeUnknownType, fmt.Sprintf("tipo de frame desconhecido: %q", frame.Type)}
+    }
+
+    var fields map[string]json.RawMessage
+    if err := json.Unmarshal(frame.Payload, &fields); err != nil || fields == nil {
+        return frame, &ProtocolError{CodeInvalidPayload, "payload deve ser um objeto"}
+    }
+    for _, name := range required {
+        var value string
+        if err := json.Unmarshal(fields[name], &value); err != nil || value == "" {
+            return frame, &ProtocolError{CodeInvalidPayload, fmt.Sprintf("campo %s é obrigatório", name)}
+        }
+    }
+
+    return frame, nil
+}
+
+// encodeFrame serializa um frame do servidor na versão atual do protocolo
+func encodeFrame(eventType string, payload interface{}) ([]byte, error) {
+    payloadBytes, ok := payload.(json.RawMessage)
+    if !ok {
+        var err error
+        if payloadBytes, err = json.Marshal(payload); err != nil {
+            return nil, err
+        }
+    }
+
+    return json.Marshal(WSMessage{
+        Version: ProtocolVersion,
+        Type:    eventType,
+        Payload: payloadBytes,
+    })
+}
@@ -0,0 +1,26 @@
+package websocket
+
+import (
+    "log"
+
+    "server/services"
+)
+
+// SendReceipts envia a cada remetente o recibo com o novo status das suas mensagens
+func (h *Hub) SendReceipts(receipts []services.Receipt) {
+    for _, receipt := range receipts {
+        h.Notify("receipt", []string{receipt.SenderID}, receipt)
+    }
+}
+
+// messageDelivered marca a mensagem como entregue após ser escrita em uma conexão do destinatário
+func (h *Hub) messageDelivered(messageID, recipientID string) {
+    receipt, err := services.MarkDelivered(messageID, recipientID)
+    if err != nil {
+        log.Printf("Erro ao marcar mensagem %s como entregue: %v", messageID, err)
+        return
+    }
+    if receipt != nil {
+        h.SendReceipts([]services.Receipt{*receipt})
+    }
+}
@@ -0,0 +1,174 @@
+package websocket
+
+import (
+    "log"
+    "time"
+
+    "server/models"
+    "server/services"
+)
+
+// bufferedFrame é um frame ao vivo recebido enquanto a conexão ainda reenviava pendências
+type bufferedFrame struct {
+    eventType string
+    messageID string
+    data      []byte
+}
+
+// maxPendingFrames limita os frames ao vivo acumulados durante um reenvio, que pode ter até
+// MaxReplayMessages mensagens e outras tantas alterações
+const maxPendingFrames = 2 * services.MaxReplayMessages
+
+// replay reenvia, em ordem, as mensagens pendentes da conexão recém-registrada e as edições e
+// exclusões de mensagens já vistas, e só então libera o tráfego ao vivo acumulado, descartando
+// mensagens já reenviadas
+func (h *Hub) replay(client *Client) {
+    // Uma busca que falha deixa o reenvio incompleto, e o sync_complete informa hasMore
+    messages, hasMore, err := services.PendingMessages(client.UserID, client.ReplayCursor)
+    if err != nil {
+        log.Printf("Erro ao buscar mensagens pendentes de %s: %v", client.UserID, err)
+        hasMore = true
+    }
+    updates, hasMoreUpdates, err := services.PendingUpdates(client.UserID, client.ReplayCursor)
+    if err != nil {
+        log.Printf("Erro ao buscar alterações pendentes de %s: %v", client.UserID, err)
+        hasMoreUpdates = true
+    }
+
+    replayed := make(map[string]bool, len(messages))
+    cursor := services.SyncCursor{}
+    for id, position := range client.ReplayCursor {
+        cursor[id] = position
+    }
+    for i := range messages {
+        frame, err := messageFrame(&messages[i], client.UserID)
+        if err != nil {
+            log.Printf("Erro ao serializar mensagem %s: %v", messages[i].ID, err)
+            continue
+        }
+        if !client.sendBlocking(frame) {
+            log.Printf("Reenvio interrompido para cliente %s (dispositivo: %s)", client.UserID, client.DeviceID)
+            return
+        }
+        replayed[messages[i].ID] = true
+        cursor.Advance(messages[i])
+    }
+    for i := range updates {
+        frame, err := updateFrame(&updates[i], client.UserID)
+        if err != nil {
+            log.Printf("Erro ao serializar alteração da mensagem %s: %v", updates[i].ID, err)
+            continue
+        }
+        if !client.sendBlocking(frame) {
+            log.Printf("Reenvio interrompido para cliente %s (dispositivo: %s)", client.UserID, client.DeviceID)
+            return
+        }
+        cursor.AdvanceChange(updates[i])
+    }
+
+    complete, _ := encodeFrame("sync_complete", map[string]interface{}{
+        "replayed": len(replayed),
+        "updated":  len(updates),
+        "cursor":   cursor.Encode(),
+        "hasMore":  hasMore || hasMoreUpdates,
+    })
+    if !client.sendBlocking(complete) {
+        return
+    }
+
+    // Novos frames podem chegar enquanto o buffer é esvaziado; repetir até não haver mais
+    for {
+        pending := client.takePending()
+        if pending == nil {
+            break
+        }
+        for _, f := range pending {
+            if f.eventType == "message" && replayed[f.messageID] {
+                continue
+            }
+            if !client.sendBlocking(f.data) {
+                return
+            }
+        }
+    }
+
+    log.Printf("Reenvio concluído para cliente %s: %d mensagens", client.UserID, len(replayed))
+}
+
+// bufferIfReplaying guarda o frame enquanto a conexão reenvia pendências. O segundo
+// retorno é falso quando o buffer está cheio e a conexão deve ser removida.
+func (c *Client) bufferIfReplaying(eventType, messageID string, data []byte) (bool, bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if !c.replaying {
+        return false, true
+    }
+    if len(c.pending) >= maxPendingFrames {
+        return true, false
+    }
+    c.pending = append(c.pending, bufferedFrame{eventType, messageID, data})
+    return true, true
+}
+
+// takePending esvazia o buffer; quando já está vazio, encerra o modo de reenvio
+func (c *Client) takePending() []bufferedFrame {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if len(c.pending) == 0 {
+        c.replaying = false
+        return nil
+    }
+    pending := c.pending
+    c.pending = nil
+    return pending
+}
+
+// sendBlocking enfileira o frame aguardando espaço no canal por até writeWait. O hub só
+// fecha o canal depois de sinalizar done e obter sendMu, então o envio nunca encontra o
+// canal fechado.
+func (c *Client) sendBlocking(frame []byte) bool {
+    timer := time.NewTimer(writeWait)
+    defer timer.Stop()
+
+    c.sendMu.RLock()
+    defer c.sendMu.RUnlock()
+
+    c.mu.Lock()
+    closed := c.closed
+    c.mu.Unlock()
+    if closed {
+        return false
+    }
+
+    select {
+    case c.Send <- frame:
+        return true
+    case <-c.done:
+        return false
+    case <-timer.C:
+        return false
+    }
+}
+
+// messageFrame monta o frame "message" com os conteúdos endereçados ao usuário
+func messageFrame(message *models.Message, userID string) ([]byte, error) {
+    payload := messagePayloadFor(message, userID)
+    payload["replayed"] = true
+    return encodeFrame("message", payload)
+}
+
+// updateFrame monta o frame "message_deleted" ou "message_edited" de uma mensagem alterada
+// enquanto a conexão estava offline
+func updateFrame(message *models.Message, userID string) ([]byte, error) {
+    if message.DeletedAt != nil {
+        payload := messageDeletedPayload(message)
+        payload["replayed"] = true
+        return encodeFrame("message_deleted", payload)
+    }
+
+    payload := messageEditedPayload(message, userID)
+    payload["replayed"] = true
+    return encodeFrame("message_edited", payload)
+}